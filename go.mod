@@ -3,10 +3,23 @@ module github.com/dottics/flight-log-api-gateway
 go 1.19
 
 require (
-	github.com/dottics/dutil v0.1.0 // indirect
-	github.com/dottics/emailserv v1.2.1 // indirect
-	github.com/dottics/securityserv v0.3.0 // indirect
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/johannesscr/micro v0.1.1 // indirect
+	github.com/dottics/dutil v0.1.0
+	github.com/dottics/emailserv v1.2.1
+	github.com/dottics/securityserv v0.3.0
+	github.com/google/uuid v1.3.0
+	github.com/gorilla/mux v1.8.0
+)
+
+require (
+	github.com/alicebob/miniredis/v2 v2.30.4
+	github.com/johannesscr/micro v0.1.1
+	github.com/redis/go-redis/v9 v9.0.5
+	golang.org/x/net v0.10.0
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
 )
@@ -1,17 +1,38 @@
 package main
 
 import (
-	"github.com/dottics/dutil"
+	"context"
+	"fmt"
 	"github.com/dottics/flight-log-api-gateway/src"
+	"github.com/dottics/flight-log-api-gateway/src/config"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	env := dutil.Env{}
-	env.Load(".env")
-	log.Println("Go API Gateway listening on port:", env.Vars["API_GW_PORT"])
-	s := src.NewServer()
+	c, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = c.Export()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Go API Gateway listening on port:", c.Port)
+	s, err := src.NewServer(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.LogPermissions()
 
-	log.Fatal(http.ListenAndServe(":"+env.Vars["API_GW_PORT"], s.Router))
+	// shutdown gracefully on SIGINT and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = s.ListenAndServe(ctx, fmt.Sprintf(":%d", c.Port))
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,101 @@
+package src
+
+import (
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"github.com/dottics/flight-log-api-gateway/src/outbox"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// deadLetters lists the emails of the outbox which could not be delivered.
+func (s *Server) deadLetters(w http.ResponseWriter, r *http.Request) {
+	xe, err := s.Outbox.Store.Dead()
+	if err != nil {
+		e := dutil.NewErr(500, "outbox", []string{"unable to list dead letters", err.Error()})
+		handler.Error(w, r, e)
+		return
+	}
+	xs := make([]outbox.Summary, len(xe))
+	for i, e := range xe {
+		xs[i] = e.Summary()
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "dead letters",
+		Data: map[string]interface{}{
+			"dead_letters": xs,
+		},
+	}
+	resp.Respond(w, r)
+}
+
+// requeueDeadLetter moves a dead letter back to the outbox for immediate
+// delivery.
+func (s *Server) requeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	entry, err := s.Outbox.Requeue(id)
+	if err == outbox.ErrNotFound {
+		e := dutil.NewErr(404, "outbox", []string{"dead letter not found"})
+		handler.Error(w, r, e)
+		return
+	}
+	if err != nil {
+		e := dutil.NewErr(500, "outbox", []string{"unable to requeue dead letter", err.Error()})
+		handler.Error(w, r, e)
+		return
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "dead letter requeued",
+		Data: map[string]interface{}{
+			"dead_letter": entry.Summary(),
+		},
+	}
+	resp.Respond(w, r)
+}
+
+// suppressions lists the addresses to which emails are not sent.
+func (s *Server) suppressions(w http.ResponseWriter, r *http.Request) {
+	xs, err := s.Suppressions.List(r.Context())
+	if err != nil {
+		e := dutil.NewErr(500, "suppression", []string{"unable to list suppressions", err.Error()})
+		handler.Error(w, r, e)
+		return
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "suppressions",
+		Data: map[string]interface{}{
+			"suppressions": xs,
+		},
+	}
+	resp.Respond(w, r)
+}
+
+// removeSuppression clears the suppression of an address so that emails
+// are sent to the address again.
+func (s *Server) removeSuppression(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+	err := s.Suppressions.Remove(r.Context(), address)
+	if err == suppression.ErrNotFound {
+		e := dutil.NewErr(404, "suppression", []string{"suppression not found"})
+		handler.Error(w, r, e)
+		return
+	}
+	if err != nil {
+		e := dutil.NewErr(500, "suppression", []string{"unable to remove suppression", err.Error()})
+		handler.Error(w, r, e)
+		return
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "suppression removed",
+	}
+	resp.Respond(w, r)
+}
@@ -0,0 +1,193 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/emailserv"
+	"github.com/dottics/flight-log-api-gateway/src/outbox"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	"github.com/gorilla/mux"
+	"github.com/johannesscr/micro/microtest"
+	"net/http/httptest"
+	"net/mail"
+	"testing"
+	"time"
+)
+
+func TestServer_deadLetters(t *testing.T) {
+	store, err := outbox.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = store.Bury(outbox.Entry{
+		ID: "a",
+		Message: &emailserv.Message{
+			To:      []mail.Address{{Address: "james@bond.com"}},
+			Subject: "Reset Password",
+		},
+		Attempts:  8,
+		LastError: "unavailable",
+		CreatedAt: created,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Outbox: outbox.New(store, nil, outbox.Options{})}
+
+	req := httptest.NewRequest("GET", "/admin/outbox/dead", nil)
+	rec := httptest.NewRecorder()
+	s.deadLetters(rec, req)
+	res, xb := microtest.ReadRecorder(rec)
+
+	if res.StatusCode != 200 {
+		t.Errorf("expected status code %d got %d", 200, res.StatusCode)
+	}
+	resp := struct {
+		Data struct {
+			DeadLetters []outbox.Summary `json:"dead_letters"`
+		} `json:"data"`
+	}{}
+	_ = json.Unmarshal(xb, &resp)
+	if len(resp.Data.DeadLetters) != 1 {
+		t.Fatalf("expected %d dead letters got %d", 1, len(resp.Data.DeadLetters))
+	}
+	dl := resp.Data.DeadLetters[0]
+	if dl.ID != "a" || dl.Subject != "Reset Password" || dl.Attempts != 8 || dl.LastError != "unavailable" {
+		t.Errorf("expected dead letter %q got %v", "a", dl)
+	}
+	if fmt.Sprint(dl.To) != "[james@bond.com]" {
+		t.Errorf("expected to %v got %v", "[james@bond.com]", dl.To)
+	}
+}
+
+func TestServer_requeueDeadLetter(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		status int
+		errors map[string][]string
+	}{
+		{
+			name:   "not found",
+			id:     "b",
+			status: 404,
+			errors: map[string][]string{"outbox": {"dead letter not found"}},
+		},
+		{
+			name:   "requeued",
+			id:     "a",
+			status: 200,
+		},
+	}
+
+	store, err := outbox.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Bury(outbox.Entry{ID: "a", Message: &emailserv.Message{}, Attempts: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Outbox: outbox.New(store, nil, outbox.Options{})}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/outbox/dead/"+tc.id+"/requeue", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tc.id})
+			rec := httptest.NewRecorder()
+			s.requeueDeadLetter(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.status {
+				t.Errorf("expected status code %d got %d", tc.status, res.StatusCode)
+			}
+			resp := dutil.Resp{}
+			_ = json.Unmarshal(xb, &resp)
+			if fmt.Sprint(resp.Errors) != fmt.Sprint(tc.errors) {
+				t.Errorf("expected errors %v got %v", tc.errors, resp.Errors)
+			}
+		})
+	}
+
+	e, err := store.Get("a")
+	if err != nil {
+		t.Fatalf("expected the dead letter to be pending got %v", err)
+	}
+	if e.Attempts != 0 {
+		t.Errorf("expected attempts %d got %d", 0, e.Attempts)
+	}
+}
+
+func TestServer_suppressions(t *testing.T) {
+	store := suppression.NewMemory()
+	_ = store.Add(context.Background(), suppression.Suppression{Address: "james@bond.com", Reason: suppression.ReasonBounce, Detail: "550"})
+	s := &Server{Suppressions: store}
+
+	req := httptest.NewRequest("GET", "/admin/suppressions", nil)
+	rec := httptest.NewRecorder()
+	s.suppressions(rec, req)
+	res, xb := microtest.ReadRecorder(rec)
+
+	if res.StatusCode != 200 {
+		t.Errorf("expected status code %d got %d", 200, res.StatusCode)
+	}
+	resp := struct {
+		Data struct {
+			Suppressions []suppression.Suppression `json:"suppressions"`
+		} `json:"data"`
+	}{}
+	_ = json.Unmarshal(xb, &resp)
+	xs := resp.Data.Suppressions
+	if len(xs) != 1 || xs[0].Address != "james@bond.com" || xs[0].Reason != suppression.ReasonBounce {
+		t.Errorf("expected the suppression of %s got %v", "james@bond.com", xs)
+	}
+}
+
+func TestServer_removeSuppression(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		status  int
+		errors  map[string][]string
+	}{
+		{
+			name:    "removed",
+			address: "James@Bond.com",
+			status:  200,
+		},
+		{
+			name:    "not found",
+			address: "james@bond.com",
+			status:  404,
+			errors:  map[string][]string{"suppression": {"suppression not found"}},
+		},
+	}
+
+	store := suppression.NewMemory()
+	_ = store.Add(context.Background(), suppression.Suppression{Address: "james@bond.com", Reason: suppression.ReasonBounce})
+	s := &Server{Suppressions: store}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/admin/suppressions/"+tc.address, nil)
+			req = mux.SetURLVars(req, map[string]string{"address": tc.address})
+			rec := httptest.NewRecorder()
+			s.removeSuppression(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.status {
+				t.Errorf("expected status code %d got %d", tc.status, res.StatusCode)
+			}
+			resp := dutil.Resp{}
+			_ = json.Unmarshal(xb, &resp)
+			if fmt.Sprint(resp.Errors) != fmt.Sprint(tc.errors) {
+				t.Errorf("expected errors %v got %v", tc.errors, resp.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// The types of the recorded events.
+const (
+	PasswordChanged             = "password_changed"
+	PasswordResetRevoked        = "password_reset_revoked"
+	PasswordResetUnknownAccount = "password_reset_unknown_account"
+)
+
+// Event is a security relevant event of an account, such as the
+// revocation of a password reset.
+type Event struct {
+	Type         string    `json:"type"`
+	Email        string    `json:"email"`
+	RemoteAddr   string    `json:"remote_addr"`
+	ForwardedFor string    `json:"forwarded_for,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// Recorder records the events.
+type Recorder interface {
+	Record(ctx context.Context, e Event) error
+}
@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog_Record(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := &Log{Logger: log.New(buf, "", 0)}
+	err := l.Record(context.Background(), Event{Type: PasswordResetRevoked, Email: "james@bond.com"})
+	if err != nil {
+		t.Errorf("expected error %v got %v", nil, err)
+	}
+	if !strings.HasPrefix(buf.String(), `audit: {"type":"password_reset_revoked","email":"j***@bond.com"`) {
+		t.Errorf("expected the event to be logged got %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "james") {
+		t.Errorf("expected the local part of the email to be masked got %s", buf.String())
+	}
+}
+
+func TestRedis_Record(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	r := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	r.Max = 2
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, email := range []string{"a@dottics.com", "b@dottics.com", "c@dottics.com"} {
+		err := r.Record(ctx, Event{Type: PasswordResetRevoked, Email: email, Time: now})
+		if err != nil {
+			t.Errorf("expected error %v got %v", nil, err)
+		}
+	}
+
+	xs, err := r.Client.LRange(ctx, r.Key, 0, -1).Result()
+	if err != nil || len(xs) != 2 {
+		t.Fatalf("expected %d events got %v %v", 2, xs, err)
+	}
+	e := Event{}
+	_ = json.Unmarshal([]byte(xs[0]), &e)
+	if e.Email != "c@dottics.com" || !e.Time.Equal(now) {
+		t.Errorf("expected the newest event first got %v", e)
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		E     string
+	}{
+		{email: "james@bond.com", E: "j***@bond.com"},
+		{email: " j@bond.com ", E: "j***@bond.com"},
+		{email: "james.bond.com", E: "***"},
+		{email: "@bond.com", E: "***"},
+		{email: "", E: "***"},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.email)
+		t.Run(name, func(t *testing.T) {
+			if s := MaskEmail(tc.email); s != tc.E {
+				t.Errorf("expected '%s' got '%s'", tc.E, s)
+			}
+		})
+	}
+}
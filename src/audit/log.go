@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+// Log records the events as JSON lines to the logger, it is used when
+// Redis is not enabled. The email of an event is masked so that the logs do
+// not hold the addresses of the users.
+type Log struct {
+	Logger *log.Logger
+}
+
+// NewLog creates a recorder which records the events to the standard
+// logger.
+func NewLog() *Log {
+	return &Log{Logger: log.Default()}
+}
+
+func (l *Log) Record(_ context.Context, e Event) error {
+	e.Email = MaskEmail(e.Email)
+	xb, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.Logger.Printf("audit: %s", xb)
+	return nil
+}
+
+// MaskEmail masks the local part of the email address so that the address
+// can be logged without the logs holding the addresses of the users. The
+// first character of the local part and the domain are kept to keep the
+// logs useful, e.g. james@bond.com is logged as j***@bond.com.
+func MaskEmail(email string) string {
+	email = strings.TrimSpace(email)
+	i := strings.LastIndex(email, "@")
+	if i < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[i:]
+}
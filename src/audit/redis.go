@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis records the events to a capped Redis list shared by all the
+// gateway replicas, the newest event first.
+type Redis struct {
+	Client *redis.Client
+	Key    string
+	// Max is the maximum number of events kept, the oldest events are
+	// dropped.
+	Max int64
+}
+
+// NewRedis creates a recorder backed by the Redis client which keeps the
+// last 10000 events.
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{
+		Client: client,
+		Key:    "flight-log-api-gateway:audit",
+		Max:    10000,
+	}
+}
+
+func (r *Redis) Record(ctx context.Context, e Event) error {
+	xb, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, r.Key, xb)
+		pipe.LTrim(ctx, r.Key, 0, r.Max-1)
+		return nil
+	})
+	return err
+}
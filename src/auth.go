@@ -0,0 +1,70 @@
+package src
+
+import (
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"net/http"
+)
+
+// authenticate validates the X-Token of the request with the security
+// microservice before calling the handler function f. The resolved user
+// and permission codes are attached to the request context which can be
+// read by the handler with handler.SessionFrom. Validated tokens are
+// cached in the Server's Sessions until the cache entry expires.
+func (s *Server) authenticate(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Token")
+		if token == "" {
+			e := dutil.NewErr(401, "authentication", []string{"token required", "please login"})
+			handler.Error(w, r, e)
+			return
+		}
+
+		session, ok := s.Sessions.Get(r.Context(), token)
+		if ok {
+			f(w, handler.WithSession(r, session))
+			return
+		}
+
+		u, xs, e := includes.Authenticate(token)
+		if e != nil {
+			err := dutil.Inst(e)
+			// any rejection of the token by the security microservice
+			// means the user is not authenticated.
+			if err.Status >= 400 && err.Status < 500 {
+				err.Status = 401
+			}
+			handler.Error(w, r, err)
+			return
+		}
+
+		session = includes.Session{
+			Token:           token,
+			User:            u,
+			PermissionCodes: xs,
+		}
+		s.Sessions.Set(r.Context(), session)
+		f(w, handler.WithSession(r, session))
+	}
+}
+
+// endSession invalidates the cached session of the request's X-Token
+// before calling the handler function f.
+func (s *Server) endSession(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Sessions.Delete(r.Context(), r.Header.Get("X-Token"))
+		f(w, r)
+	}
+}
+
+// evictSession invalidates the cached session of the request's X-Token
+// after calling the handler function f, so that the next request with the
+// token is validated again with the security microservice. It is used by
+// the routes which change the credentials of the user.
+func (s *Server) evictSession(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f(w, r)
+		s.Sessions.Delete(r.Context(), r.Header.Get("X-Token"))
+	}
+}
@@ -0,0 +1,176 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/cache"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/johannesscr/micro/microtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer_authenticate(t *testing.T) {
+	type E struct {
+		status int
+		data   string
+	}
+	tests := []struct {
+		name     string
+		token    string
+		exchange *microtest.Exchange
+		E        E
+	}{
+		{
+			name:     "missing token",
+			token:    "",
+			exchange: nil,
+			E: E{
+				status: 401,
+				data:   `{"message":"Unauthorized","data":null,"errors":{"authentication":["token required","please login"]}}`,
+			},
+		},
+		{
+			name:  "invalid token",
+			token: "invalid-token",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 403,
+					Body:   `{"message":"Forbidden","data":null,"errors":{"authentication":["invalid token"]}}`,
+				},
+			},
+			E: E{
+				status: 401,
+				data:   `{"message":"Unauthorized","data":null,"errors":{"authentication":["invalid token"]}}`,
+			},
+		},
+		{
+			name:  "security service error",
+			token: "valid-token",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 500,
+					Body:   `{"message":"InternalServerError","data":null,"errors":{"internal_server_error":["unexpected error"]}}`,
+				},
+			},
+			E: E{
+				status: 500,
+				data:   `{"message":"Internal Server Error","data":null,"errors":{"internal_server_error":["unexpected error"]}}`,
+			},
+		},
+		{
+			name:  "authenticated",
+			token: "valid-token",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"token valid","data":{"user":{"email":"james@bond.com","active":true},"permission":["aio2"]},"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"james@bond.com","data":["aio2"],"errors":null}`,
+			},
+		},
+		{
+			name:     "authenticated from cache",
+			token:    "valid-token",
+			exchange: nil,
+			E: E{
+				status: 200,
+				data:   `{"message":"james@bond.com","data":["aio2"],"errors":null}`,
+			},
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	s := &Server{Sessions: cache.NewLRU(10, time.Minute)}
+	f := s.authenticate(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := handler.SessionFrom(r)
+		resp := dutil.Resp{
+			Status:  200,
+			Message: session.User.Email,
+			Data:    session.PermissionCodes,
+		}
+		resp.Respond(w, r)
+	})
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			headers := map[string][]string{"X-Token": {tc.token}}
+			req := microtest.NewRequest("GET", "/", nil, headers, nil)
+			rec := httptest.NewRecorder()
+			f(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+		})
+	}
+}
+
+func TestServer_endSession(t *testing.T) {
+	s := &Server{Sessions: cache.NewLRU(10, time.Minute)}
+	ctx := context.Background()
+	s.Sessions.Set(ctx, includes.Session{Token: "my-token"})
+
+	f := s.endSession(func(w http.ResponseWriter, r *http.Request) {
+		resp := dutil.Resp{Status: 200, Message: "logout successful"}
+		resp.Respond(w, r)
+	})
+	headers := map[string][]string{"X-Token": {"my-token"}}
+	req := microtest.NewRequest("DELETE", "/logout", nil, headers, nil)
+	rec := httptest.NewRecorder()
+	f(rec, req)
+
+	if rec.Code != 200 {
+		t.Errorf("expected status code %d got %d", 200, rec.Code)
+	}
+	if _, ok := s.Sessions.Get(ctx, "my-token"); ok {
+		t.Errorf("expected the session to be invalidated")
+	}
+}
+
+func TestServer_evictSession(t *testing.T) {
+	s := &Server{Sessions: cache.NewLRU(10, time.Minute)}
+	ctx := context.Background()
+	s.Sessions.Set(ctx, includes.Session{Token: "my-token"})
+	s.Sessions.Set(ctx, includes.Session{Token: "other-token"})
+
+	f := s.evictSession(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.Sessions.Get(r.Context(), "my-token"); !ok {
+			t.Errorf("expected the session to be cached while handling the request")
+		}
+		resp := dutil.Resp{Status: 200, Message: "password changed successfully"}
+		resp.Respond(w, r)
+	})
+	headers := map[string][]string{"X-Token": {"my-token"}}
+	req := microtest.NewRequest("POST", "/change-password", nil, headers, nil)
+	rec := httptest.NewRecorder()
+	f(rec, req)
+
+	if rec.Code != 200 {
+		t.Errorf("expected status code %d got %d", 200, rec.Code)
+	}
+	if _, ok := s.Sessions.Get(ctx, "my-token"); ok {
+		t.Errorf("expected the session to be invalidated")
+	}
+	if _, ok := s.Sessions.Get(ctx, "other-token"); !ok {
+		t.Errorf("expected the other session to remain cached")
+	}
+}
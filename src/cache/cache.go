@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+)
+
+// Sessions caches the sessions of tokens which have been validated by
+// the security microservice so that not every authenticated request
+// requires an exchange with the security microservice.
+type Sessions interface {
+	// Get returns the cached session of the token. The boolean is false
+	// if the token is not cached or the cached session has expired.
+	Get(ctx context.Context, token string) (includes.Session, bool)
+	// Set caches the session by the session's token.
+	Set(ctx context.Context, session includes.Session)
+	// Delete invalidates the cached session of the token.
+	Delete(ctx context.Context, token string)
+}
+
+// key hashes the token so that raw tokens are never used as cache keys.
+func key(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
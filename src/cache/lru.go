@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	session includes.Session
+	expires time.Time
+}
+
+// LRU is an in-process least-recently-used session cache. It is used when
+// Redis is disabled and therefore sessions are not shared across gateway
+// replicas.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+// NewLRU creates a session cache which holds at most size sessions, each
+// of which expires after the ttl.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+func (c *LRU) Get(_ context.Context, token string) (includes.Session, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key(token)]
+	if !ok {
+		return includes.Session{}, false
+	}
+	en := el.Value.(*entry)
+	if c.now().After(en.expires) {
+		c.order.Remove(el)
+		delete(c.entries, en.key)
+		return includes.Session{}, false
+	}
+	c.order.MoveToFront(el)
+	return en.session, true
+}
+
+func (c *LRU) Set(_ context.Context, session includes.Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(session.Token)
+	if el, ok := c.entries[k]; ok {
+		en := el.Value.(*entry)
+		en.session = session
+		en.expires = c.now().Add(c.ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+
+	en := &entry{
+		key:     k,
+		session: session,
+		expires: c.now().Add(c.ttl),
+	}
+	c.entries[k] = c.order.PushFront(en)
+	for c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.entries, el.Value.(*entry).key)
+	}
+}
+
+func (c *LRU) Delete(_ context.Context, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(token)
+	if el, ok := c.entries[k]; ok {
+		c.order.Remove(el)
+		delete(c.entries, k)
+	}
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	security "github.com/dottics/securityserv"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	c := NewLRU(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	a := includes.Session{Token: "a", User: security.User{Email: "a@dottics.com"}}
+	b := includes.Session{Token: "b", User: security.User{Email: "b@dottics.com"}}
+	d := includes.Session{Token: "d", User: security.User{Email: "d@dottics.com"}}
+
+	c.Set(ctx, a)
+	c.Set(ctx, b)
+	session, ok := c.Get(ctx, "a")
+	if !ok || session.User.Email != a.User.Email {
+		t.Errorf("expected session %v got %v", a, session)
+	}
+
+	// b is the least recently used and is evicted
+	c.Set(ctx, d)
+	if _, ok := c.Get(ctx, "b"); ok {
+		t.Errorf("expected session b to be evicted")
+	}
+	if _, ok := c.Get(ctx, "d"); !ok {
+		t.Errorf("expected session d to be cached")
+	}
+
+	c.Delete(ctx, "d")
+	if _, ok := c.Get(ctx, "d"); ok {
+		t.Errorf("expected session d to be deleted")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Get(ctx, "a"); ok {
+		t.Errorf("expected session a to be expired")
+	}
+}
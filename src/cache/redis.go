@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// Redis is a session cache which is shared by all the gateway replicas
+// connected to the same Redis instance. Any Redis error is logged and
+// treated as a cache miss so that the security microservice remains the
+// source of truth.
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+	ttl    time.Duration
+}
+
+// NewRedis creates a Redis session cache where each session expires after
+// the ttl.
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{
+		Client: client,
+		Prefix: "flight-log-api-gateway:session:",
+		ttl:    ttl,
+	}
+}
+
+func (c *Redis) Get(ctx context.Context, token string) (includes.Session, bool) {
+	xb, err := c.Client.Get(ctx, c.Prefix+key(token)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Println("session cache get:", err)
+		}
+		return includes.Session{}, false
+	}
+	session := includes.Session{}
+	err = json.Unmarshal(xb, &session)
+	if err != nil {
+		log.Println("session cache unmarshal:", err)
+		return includes.Session{}, false
+	}
+	// the token is not stored with the session
+	session.Token = token
+	return session, true
+}
+
+func (c *Redis) Set(ctx context.Context, session includes.Session) {
+	xb, err := json.Marshal(session)
+	if err != nil {
+		log.Println("session cache marshal:", err)
+		return
+	}
+	err = c.Client.Set(ctx, c.Prefix+key(session.Token), xb, c.ttl).Err()
+	if err != nil {
+		log.Println("session cache set:", err)
+	}
+}
+
+func (c *Redis) Delete(ctx context.Context, token string) {
+	err := c.Client.Del(ctx, c.Prefix+key(token)).Err()
+	if err != nil {
+		log.Println("session cache delete:", err)
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	security "github.com/dottics/securityserv"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	c := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Minute)
+
+	a := includes.Session{
+		Token:           "a-bearer-token",
+		User:            security.User{Email: "a@dottics.com"},
+		PermissionCodes: security.PermissionCodes{"aio2"},
+	}
+	if _, ok := c.Get(ctx, "a-bearer-token"); ok {
+		t.Errorf("expected session a not to be cached")
+	}
+
+	c.Set(ctx, a)
+	session, ok := c.Get(ctx, "a-bearer-token")
+	if !ok || session.Token != a.Token || session.User.Email != a.User.Email || session.PermissionCodes[0] != "aio2" {
+		t.Errorf("expected session %v got %v", a, session)
+	}
+	if mr.Exists(c.Prefix + a.Token) {
+		t.Errorf("expected the raw token not to be used as a key")
+	}
+	for _, k := range mr.Keys() {
+		v, _ := mr.Get(k)
+		if strings.Contains(v, a.Token) {
+			t.Errorf("expected the token not to be stored got %s", v)
+		}
+	}
+
+	c.Delete(ctx, "a-bearer-token")
+	if _, ok := c.Get(ctx, "a-bearer-token"); ok {
+		t.Errorf("expected session a to be deleted")
+	}
+
+	c.Set(ctx, a)
+	mr.FastForward(2 * time.Minute)
+	if _, ok := c.Get(ctx, "a-bearer-token"); ok {
+		t.Errorf("expected session a to be expired")
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"net/mail"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Config is the typed configuration of the API gateway. It is loaded and
+// validated once at startup and passed to the components which require
+// it, rather than each component reading the process environment.
+type Config struct {
+	Env     string
+	WorkDir string
+	Port    int
+
+	App             Service
+	SecurityService Service
+	EmailService    Service
+
+	// DefaultLocale is the locale of the emails when the request has no
+	// locale with templates.
+	DefaultLocale string
+	// EmailArchiveDir is the directory to which a copy of every rendered
+	// email is written. Archiving is disabled when it is empty.
+	EmailArchiveDir string
+	Email           Email
+
+	// Brands are the brands of the applications served by the gateway by
+	// name, DefaultBrand is the brand of the requests of which the host is
+	// not one of the Hosts of a brand.
+	Brands       map[string]Brand
+	DefaultBrand string
+
+	// AdminPermissionCodes are the permission codes of which a user requires
+	// at least one to access the admin routes.
+	AdminPermissionCodes []string
+
+	CORS         CORS
+	Redis        Redis
+	SessionCache SessionCache
+	RateLimit    RateLimit
+	ContactUs    ContactUs
+	// ForgotPassword configures the forgot password flow.
+	ForgotPassword ForgotPassword
+	VerifyEmail    VerifyEmail
+	Outbox         Outbox
+	Timeouts       Timeouts
+	// HealthProbeTimeout limits how long each readiness probe may take.
+	HealthProbeTimeout time.Duration
+}
+
+// Service is the scheme and host of an application or microservice.
+type Service struct {
+	Scheme string
+	Host   string
+}
+
+// URL returns the URL of the service with the path p.
+func (s Service) URL(p string) url.URL {
+	return url.URL{
+		Scheme: s.Scheme,
+		Host:   s.Host,
+		Path:   p,
+	}
+}
+
+// Email configures the senders, recipients and subjects of the emails so
+// that each environment has its own.
+type Email struct {
+	// From is the sender and ReplyTo the reply-to address of every email
+	// of which the template does not have its own.
+	From    mail.Address
+	ReplyTo mail.Address
+	// Templates is the configuration of the email templates by name.
+	Templates map[string]EmailTemplate
+	// WebhookSecret is the secret with which the delivery events posted to
+	// the email webhook are signed. The webhook is disabled when empty.
+	WebhookSecret string
+	// WebhookTolerance is how far the signed timestamp of a delivery event
+	// may be from the time it is received before it is refused as a replay.
+	WebhookTolerance time.Duration
+}
+
+// EmailTemplate replaces the sender, recipients and subjects of an email
+// template, the fields which are not set are not replaced.
+type EmailTemplate struct {
+	From    mail.Address
+	ReplyTo mail.Address
+	To      []mail.Address
+	CC      []mail.Address
+	Subject string
+	// Subjects is the subject by locale.
+	Subjects map[string]string
+}
+
+// Brand is the identity of an application in the emails, such that the
+// same templates serve every application.
+type Brand struct {
+	Name    string
+	LogoURL string
+	Colors  BrandColors
+	// FooterLinks are the links in the footer of the emails after the home
+	// and contact us links.
+	FooterLinks []Link
+	Support     mail.Address
+	// App is the application to which the links of the emails refer.
+	App Service
+	// Hosts are the request hosts of the brand.
+	Hosts []string
+}
+
+// BrandColors are the hex colours of a brand, the primary colour is used
+// on a light background and the secondary colour on a dark background.
+type BrandColors struct {
+	Primary   string
+	Secondary string
+}
+
+// Link is a link with its text.
+type Link struct {
+	Text string
+	URL  string
+}
+
+// CORS is the Cross-Origin Resource Sharing policy of the gateway.
+type CORS struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+// Redis is the connection to the Redis instance shared by the gateway
+// replicas.
+type Redis struct {
+	Enabled  bool
+	Host     string
+	Password string
+}
+
+// SessionCache configures the cache of validated tokens.
+type SessionCache struct {
+	TTL  time.Duration
+	Size int
+}
+
+// RateLimit configures the rate limits of the routes. Limits are keyed by
+// "<route>:<bucket>" such as "forgot-password:email".
+type RateLimit struct {
+	TrustProxy bool
+	Limits     map[string]ratelimit.Limit
+}
+
+// ContactUs configures the validation and spam protection of the contact
+// us form.
+type ContactUs struct {
+	NameMaxLength    int
+	MessageMaxLength int
+	// MaxLinks is the maximum number of links in the message.
+	MaxLinks int
+	// BlockedKeywords are the lower-case words of which the name and
+	// message may not contain any.
+	BlockedKeywords []string
+	// MinSubmitTime is the minimum time to fill out the form, a form which
+	// is submitted faster is considered spam. It is disabled when zero.
+	MinSubmitTime time.Duration
+	// Acknowledge sends the sender an acknowledgement of the message. The
+	// acknowledgements to an address are limited by the
+	// "contact-us-acknowledgement:email" rate limit.
+	Acknowledge bool
+	// Categories are the lower-case categories of which a message may be,
+	// a message without a category is of no category.
+	Categories []string
+	// Routes are the recipients of the messages by category. A message of
+	// a category without a route is sent to the contact-us recipients.
+	Routes map[string][]mail.Address
+}
+
+// ForgotPassword configures the forgot password flow. The flow is
+// enumeration safe when EnumerationSafe is set: a request for an address
+// without an account receives the same response as a request for an
+// address with an account, and every response takes at least MinDuration.
+type ForgotPassword struct {
+	EnumerationSafe bool
+	MinDuration     time.Duration
+}
+
+// VerifyEmail configures the email verification of the registered users.
+// The verification links are signed with Secret and expire after LinkTTL.
+// Registration is disabled when Secret is empty.
+type VerifyEmail struct {
+	Secret  string
+	LinkTTL time.Duration
+}
+
+// Outbox configures the asynchronous delivery of emails. The outbox is
+// disabled and emails are sent synchronously when Dir is empty.
+type Outbox struct {
+	Dir          string
+	Workers      int
+	MaxAttempts  int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+	PollInterval time.Duration
+}
+
+// Timeouts configures the http.Server and the graceful shutdown of the
+// gateway.
+type Timeouts struct {
+	Read       time.Duration
+	ReadHeader time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+	// Drain is how long the gateway reports not ready before it stops
+	// accepting connections, so that load balancers stop routing to it.
+	Drain time.Duration
+	// Shutdown is the maximum time to wait for in-flight requests and
+	// background work to complete.
+	Shutdown time.Duration
+}
+
+// Export sets the microservice environment variables from the Config.
+// The microservice packages (securityserv, emailserv) read their scheme
+// and host from the process environment.
+func (c *Config) Export() error {
+	vars := map[string]string{
+		"SECURITY_SERVICE_SCHEME": c.SecurityService.Scheme,
+		"SECURITY_SERVICE_HOST":   c.SecurityService.Host,
+		"EMAIL_SERVICE_SCHEME":    c.EmailService.Scheme,
+		"EMAIL_SERVICE_HOST":      c.EmailService.Host,
+	}
+	for key, value := range vars {
+		err := os.Setenv(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,800 @@
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var localeRe = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+var colorRe = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// ValidationError is the report of every invalid configuration value.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// Load loads the configuration from the .env file, the process environment
+// and the command-line flags args, where each overrides the previous. Only
+// the variables of the process environment which configure the gateway
+// are loaded. The .env file is ".env" unless set with the -env-file flag.
+// The configuration is validated and an error reports every invalid value.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("flight-log-api-gateway", flag.ContinueOnError)
+	envFile := fs.String("env-file", ".env", "the .env file to load")
+	port := fs.String("port", "", "the port to listen on, overrides API_GW_PORT")
+	workDir := fs.String("workdir", "", "the working directory, overrides WORKDIR")
+	env := fs.String("env", "", "the environment, overrides ENV")
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := ReadEnvFile(*envFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range os.Environ() {
+		xs := strings.SplitN(kv, "=", 2)
+		if knownKey(xs[0]) {
+			vars[xs[0]] = xs[1]
+		}
+	}
+	flags := map[string]string{
+		"API_GW_PORT": *port,
+		"WORKDIR":     *workDir,
+		"ENV":         *env,
+	}
+	for key, value := range flags {
+		if value != "" {
+			vars[key] = value
+		}
+	}
+	return Parse(vars)
+}
+
+// knownKeys are the variables of the configuration which are not of a
+// family such as BRAND_<NAME>_<FIELD>.
+var knownKeys = map[string]bool{
+	"ENV":                              true,
+	"WORKDIR":                          true,
+	"API_GW_PORT":                      true,
+	"APP_SCHEME":                       true,
+	"APP_HOST":                         true,
+	"SECURITY_SERVICE_SCHEME":          true,
+	"SECURITY_SERVICE_HOST":            true,
+	"EMAIL_SERVICE_SCHEME":             true,
+	"EMAIL_SERVICE_HOST":               true,
+	"DEFAULT_LOCALE":                   true,
+	"DEFAULT_BRAND":                    true,
+	"EMAIL_ARCHIVE_DIR":                true,
+	"EMAIL_FROM":                       true,
+	"EMAIL_REPLY_TO":                   true,
+	"EMAIL_WEBHOOK_SECRET":             true,
+	"EMAIL_WEBHOOK_TOLERANCE":          true,
+	"CORS_ALLOWED_ORIGINS":             true,
+	"CORS_ALLOWED_METHODS":             true,
+	"CORS_ALLOWED_HEADERS":             true,
+	"CORS_EXPOSED_HEADERS":             true,
+	"CORS_ALLOW_CREDENTIALS":           true,
+	"CORS_MAX_AGE":                     true,
+	"ADMIN_PERMISSION_CODES":           true,
+	"REDIS_ENABLED":                    true,
+	"REDIS_HOST":                       true,
+	"REDIS_PASSWORD":                   true,
+	"SESSION_CACHE_SIZE":               true,
+	"SESSION_CACHE_TTL":                true,
+	"RATE_LIMIT_TRUST_PROXY":           true,
+	"HEALTH_PROBE_TIMEOUT":             true,
+	"SERVER_READ_TIMEOUT":              true,
+	"SERVER_READ_HEADER_TIMEOUT":       true,
+	"SERVER_WRITE_TIMEOUT":             true,
+	"SERVER_IDLE_TIMEOUT":              true,
+	"SERVER_DRAIN_PERIOD":              true,
+	"SERVER_SHUTDOWN_TIMEOUT":          true,
+	"OUTBOX_DIR":                       true,
+	"OUTBOX_WORKERS":                   true,
+	"OUTBOX_POLL_INTERVAL":             true,
+	"OUTBOX_MAX_ATTEMPTS":              true,
+	"OUTBOX_BACKOFF_BASE":              true,
+	"OUTBOX_BACKOFF_MAX":               true,
+	"CONTACT_US_ACKNOWLEDGE":           true,
+	"CONTACT_US_CATEGORIES":            true,
+	"CONTACT_US_BLOCKED_KEYWORDS":      true,
+	"CONTACT_US_MAX_LINKS":             true,
+	"CONTACT_US_MESSAGE_MAX_LENGTH":    true,
+	"CONTACT_US_MIN_SUBMIT_TIME":       true,
+	"CONTACT_US_NAME_MAX_LENGTH":       true,
+	"FORGOT_PASSWORD_ENUMERATION_SAFE": true,
+	"FORGOT_PASSWORD_MIN_DURATION":     true,
+	"VERIFY_EMAIL_SECRET":              true,
+	"VERIFY_EMAIL_LINK_TTL":            true,
+}
+
+// knownKey reports whether the variable key configures the gateway, so
+// that only those variables of the process environment are loaded. The
+// other variables of the environment, which may share a prefix with a
+// family, are ignored.
+func knownKey(key string) bool {
+	if knownKeys[key] {
+		return true
+	}
+	hasSuffix := func(name string, xs ...string) bool {
+		for _, x := range xs {
+			if strings.HasSuffix(name, "_"+x) && len(name) > len(x)+1 {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case strings.HasPrefix(key, "RATE_LIMIT_"):
+		return hasSuffix(strings.TrimPrefix(key, "RATE_LIMIT_"), "IP", "EMAIL")
+	case strings.HasPrefix(key, "CONTACT_US_ROUTE_"):
+		return len(key) > len("CONTACT_US_ROUTE_")
+	case strings.HasPrefix(key, "BRAND_"):
+		return hasSuffix(strings.TrimPrefix(key, "BRAND_"), brandFields...)
+	case strings.HasPrefix(key, "EMAIL_"):
+		name := strings.TrimPrefix(key, "EMAIL_")
+		return hasSuffix(name, "FROM", "REPLY_TO", "TO", "CC", "SUBJECT") || strings.LastIndex(name, "_SUBJECT_") > 0
+	}
+	return false
+}
+
+// ReadEnvFile reads the KEY=VALUE pairs of a .env file. Blank lines and
+// lines starting with # are ignored. A file which does not exist is
+// treated as empty.
+func ReadEnvFile(name string) (map[string]string, error) {
+	vars := make(map[string]string)
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return vars, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	n := 0
+	for sc.Scan() {
+		n++
+		ln := strings.TrimSpace(sc.Text())
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		xs := strings.SplitN(ln, "=", 2)
+		if len(xs) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", name, n)
+		}
+		vars[strings.TrimSpace(xs[0])] = strings.TrimSpace(xs[1])
+	}
+	return vars, sc.Err()
+}
+
+// Parse parses and validates the configuration variables.
+func Parse(vars map[string]string) (*Config, error) {
+	p := &parser{vars: vars}
+	c := &Config{}
+
+	c.Env = p.oneOf("ENV", "", "local", "development", "staging", "production")
+	c.WorkDir = p.dir("WORKDIR")
+	c.Port = p.int("API_GW_PORT", -1, 1, 65535)
+
+	c.App = p.service("APP")
+	c.SecurityService = p.service("SECURITY_SERVICE")
+	c.EmailService = p.service("EMAIL_SERVICE")
+	c.DefaultLocale = p.locale("DEFAULT_LOCALE", "en")
+	c.EmailArchiveDir = p.optionalDir("EMAIL_ARCHIVE_DIR")
+	c.Email = Email{
+		From:             p.address("EMAIL_FROM", true),
+		ReplyTo:          p.address("EMAIL_REPLY_TO", false),
+		Templates:        p.emailTemplates(),
+		WebhookSecret:    strings.TrimSpace(vars["EMAIL_WEBHOOK_SECRET"]),
+		WebhookTolerance: p.duration("EMAIL_WEBHOOK_TOLERANCE", 5*time.Minute, time.Second),
+	}
+
+	c.Brands = p.brands(c.App)
+	if len(c.Brands) == 0 {
+		p.problem("BRAND_<NAME>_NAME", "required, at least one brand")
+	} else if len(c.Brands) == 1 {
+		c.DefaultBrand = p.oneOf("DEFAULT_BRAND", sortedKeys(c.Brands)[0], sortedKeys(c.Brands)...)
+	} else {
+		c.DefaultBrand = p.oneOf("DEFAULT_BRAND", "", sortedKeys(c.Brands)...)
+	}
+
+	c.AdminPermissionCodes = p.list("ADMIN_PERMISSION_CODES", []string{"admin"})
+
+	c.CORS = CORS{
+		AllowedOrigins:   p.origins("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		AllowedMethods:   p.list("CORS_ALLOWED_METHODS", []string{"OPTIONS", "GET", "POST", "PUT", "DELETE"}),
+		AllowedHeaders:   p.list("CORS_ALLOWED_HEADERS", []string{"Content-Type", "X-Token"}),
+		ExposedHeaders:   p.list("CORS_EXPOSED_HEADERS", []string{"X-Token"}),
+		AllowCredentials: p.bool("CORS_ALLOW_CREDENTIALS", false),
+		MaxAge:           p.int("CORS_MAX_AGE", 0, 0, 86400),
+	}
+	if c.CORS.AllowCredentials && contains(c.CORS.AllowedOrigins, "*") {
+		p.problem("CORS_ALLOW_CREDENTIALS", "credentials may not be allowed with the CORS_ALLOWED_ORIGINS *")
+	}
+
+	c.Redis = Redis{
+		Enabled:  p.bool("REDIS_ENABLED", false),
+		Password: vars["REDIS_PASSWORD"],
+	}
+	if c.Redis.Enabled {
+		c.Redis.Host = p.host("REDIS_HOST")
+	}
+	c.SessionCache = SessionCache{
+		TTL:  p.duration("SESSION_CACHE_TTL", 5*time.Minute, time.Second),
+		Size: p.int("SESSION_CACHE_SIZE", 1024, 1, 1<<20),
+	}
+
+	c.RateLimit = RateLimit{
+		TrustProxy: p.bool("RATE_LIMIT_TRUST_PROXY", false),
+		Limits:     p.rateLimits(),
+	}
+
+	c.ContactUs = ContactUs{
+		NameMaxLength:    p.int("CONTACT_US_NAME_MAX_LENGTH", 100, 1, 1000),
+		MessageMaxLength: p.int("CONTACT_US_MESSAGE_MAX_LENGTH", 5000, 1, 100000),
+		MaxLinks:         p.int("CONTACT_US_MAX_LINKS", 2, 0, 100),
+		BlockedKeywords:  p.list("CONTACT_US_BLOCKED_KEYWORDS", nil),
+		MinSubmitTime:    p.duration("CONTACT_US_MIN_SUBMIT_TIME", 3*time.Second, 0),
+		Acknowledge:      p.bool("CONTACT_US_ACKNOWLEDGE", true),
+	}
+	for i, k := range c.ContactUs.BlockedKeywords {
+		c.ContactUs.BlockedKeywords[i] = strings.ToLower(k)
+	}
+	c.ContactUs.Categories = p.categories("CONTACT_US_CATEGORIES")
+	c.ContactUs.Routes = p.contactUsRoutes(c.ContactUs.Categories)
+
+	c.ForgotPassword = ForgotPassword{
+		EnumerationSafe: p.bool("FORGOT_PASSWORD_ENUMERATION_SAFE", true),
+		MinDuration:     p.duration("FORGOT_PASSWORD_MIN_DURATION", time.Second, 0),
+	}
+
+	c.VerifyEmail = VerifyEmail{
+		Secret:  strings.TrimSpace(vars["VERIFY_EMAIL_SECRET"]),
+		LinkTTL: p.duration("VERIFY_EMAIL_LINK_TTL", 24*time.Hour, time.Minute),
+	}
+
+	c.Outbox = Outbox{
+		Dir:          strings.TrimSpace(vars["OUTBOX_DIR"]),
+		Workers:      p.int("OUTBOX_WORKERS", 4, 1, 64),
+		MaxAttempts:  p.int("OUTBOX_MAX_ATTEMPTS", 8, 1, 100),
+		BackoffBase:  p.duration("OUTBOX_BACKOFF_BASE", 10*time.Second, time.Millisecond),
+		BackoffMax:   p.duration("OUTBOX_BACKOFF_MAX", 30*time.Minute, time.Millisecond),
+		PollInterval: p.duration("OUTBOX_POLL_INTERVAL", time.Second, time.Millisecond),
+	}
+	if c.Outbox.BackoffMax < c.Outbox.BackoffBase {
+		p.problem("OUTBOX_BACKOFF_MAX", "%s must be at least OUTBOX_BACKOFF_BASE %s", c.Outbox.BackoffMax, c.Outbox.BackoffBase)
+	}
+
+	c.Timeouts = Timeouts{
+		Read:       p.duration("SERVER_READ_TIMEOUT", 15*time.Second, time.Second),
+		ReadHeader: p.duration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second, time.Second),
+		Write:      p.duration("SERVER_WRITE_TIMEOUT", 30*time.Second, time.Second),
+		Idle:       p.duration("SERVER_IDLE_TIMEOUT", 60*time.Second, time.Second),
+		Drain:      p.duration("SERVER_DRAIN_PERIOD", 5*time.Second, 0),
+		Shutdown:   p.duration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second, time.Second),
+	}
+	c.HealthProbeTimeout = p.duration("HEALTH_PROBE_TIMEOUT", 2*time.Second, time.Millisecond)
+
+	if len(p.problems) > 0 {
+		return nil, &ValidationError{Problems: p.problems}
+	}
+	return c, nil
+}
+
+// parser reads the configuration variables and records a problem for each
+// invalid value instead of failing on the first.
+type parser struct {
+	vars     map[string]string
+	problems []string
+}
+
+func (p *parser) problem(key, format string, a ...interface{}) {
+	p.problems = append(p.problems, fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, a...)))
+}
+
+// required returns the value of the key and records a problem if the key
+// is not set.
+func (p *parser) required(key string) string {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		p.problem(key, "required")
+	}
+	return v
+}
+
+func (p *parser) oneOf(key string, d string, values ...string) string {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" && d != "" {
+		return d
+	}
+	for _, value := range values {
+		if v == value {
+			return v
+		}
+	}
+	if v == "" {
+		p.problem(key, "required, one of %s", strings.Join(values, ", "))
+	} else {
+		p.problem(key, "'%s' must be one of %s", v, strings.Join(values, ", "))
+	}
+	return v
+}
+
+func (p *parser) dir(key string) string {
+	v := p.required(key)
+	if v == "" {
+		return v
+	}
+	fi, err := os.Stat(v)
+	if err != nil || !fi.IsDir() {
+		p.problem(key, "'%s' is not a directory", v)
+	}
+	return v
+}
+
+// optionalDir returns the value of the key, which must be an existing
+// directory when set.
+func (p *parser) optionalDir(key string) string {
+	if strings.TrimSpace(p.vars[key]) == "" {
+		return ""
+	}
+	return p.dir(key)
+}
+
+// locale parses a lower-case locale such as "en" or "de-ch".
+func (p *parser) locale(key string, d string) string {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		return d
+	}
+	if !localeRe.MatchString(v) {
+		p.problem(key, "'%s' is not a valid locale", v)
+	}
+	return v
+}
+
+// address parses an email address such as "Dottics <mail@dottics.com>".
+func (p *parser) address(key string, required bool) mail.Address {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		if required {
+			p.problem(key, "required")
+		}
+		return mail.Address{}
+	}
+	a, err := mail.ParseAddress(v)
+	if err != nil {
+		p.problem(key, "'%s' is not a valid address", v)
+		return mail.Address{}
+	}
+	return *a
+}
+
+// addresses parses a comma separated list of email addresses.
+func (p *parser) addresses(key string) []mail.Address {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		return nil
+	}
+	xa, err := mail.ParseAddressList(v)
+	if err != nil {
+		p.problem(key, "'%s' is not a valid address list", v)
+		return nil
+	}
+	addrs := make([]mail.Address, len(xa))
+	for i, a := range xa {
+		addrs[i] = *a
+	}
+	return addrs
+}
+
+// int parses an integer in the range [min, max]. If d is negative the key
+// is required, otherwise d is the default.
+func (p *parser) int(key string, d, min, max int) int {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		if d < 0 {
+			p.problem(key, "required")
+		}
+		return d
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		p.problem(key, "'%s' is not an integer", v)
+		return d
+	}
+	if n < min || n > max {
+		p.problem(key, "%d is not in the range %d to %d", n, min, max)
+	}
+	return n
+}
+
+func (p *parser) bool(key string, d bool) bool {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		return d
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		p.problem(key, "'%s' is not a boolean", v)
+		return d
+	}
+	return b
+}
+
+// duration parses a duration such as "15s" which is at least min.
+func (p *parser) duration(key string, d, min time.Duration) time.Duration {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		return d
+	}
+	t, err := time.ParseDuration(v)
+	if err != nil {
+		p.problem(key, "'%s' is not a duration", v)
+		return d
+	}
+	if t < min {
+		p.problem(key, "%s must be at least %s", t, min)
+	}
+	return t
+}
+
+// list parses a comma separated list.
+func (p *parser) list(key string, d []string) []string {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		return d
+	}
+	xs := make([]string, 0)
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			xs = append(xs, s)
+		}
+	}
+	return xs
+}
+
+// origins parses a list of origins, each must be "*" or a URL with only a
+// scheme and host.
+func (p *parser) origins(key string, d []string) []string {
+	xs := p.list(key, d)
+	for _, o := range xs {
+		if o == "*" {
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			p.problem(key, "'%s' is not a valid origin", o)
+		}
+	}
+	return xs
+}
+
+// host parses a required host with an optional port.
+func (p *parser) host(key string) string {
+	v := p.required(key)
+	if v == "" {
+		return v
+	}
+	h := v
+	if strings.Contains(v, ":") {
+		var port string
+		var err error
+		h, port, err = net.SplitHostPort(v)
+		if err != nil {
+			p.problem(key, "'%s' is not a valid host", v)
+			return v
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			p.problem(key, "'%s' has an invalid port", v)
+			return v
+		}
+	}
+	if h == "" || strings.ContainsAny(h, "/?#@ ") {
+		p.problem(key, "'%s' is not a valid host", v)
+	}
+	return v
+}
+
+// service parses the <prefix>_SCHEME and <prefix>_HOST of a service.
+func (p *parser) service(prefix string) Service {
+	return Service{
+		Scheme: p.oneOf(prefix+"_SCHEME", "", "http", "https"),
+		Host:   p.host(prefix + "_HOST"),
+	}
+}
+
+// rateLimits parses every RATE_LIMIT_<ROUTE>_<BUCKET> variable, where the
+// bucket is IP or EMAIL.
+func (p *parser) rateLimits() map[string]ratelimit.Limit {
+	limits := make(map[string]ratelimit.Limit)
+	keys := make([]string, 0)
+	for key := range p.vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := p.vars[key]
+		if !strings.HasPrefix(key, "RATE_LIMIT_") || key == "RATE_LIMIT_TRUST_PROXY" {
+			continue
+		}
+		name := strings.TrimPrefix(key, "RATE_LIMIT_")
+		i := strings.LastIndex(name, "_")
+		if i <= 0 {
+			p.problem(key, "expected RATE_LIMIT_<ROUTE>_<IP|EMAIL>")
+			continue
+		}
+		route := strings.ToLower(strings.ReplaceAll(name[:i], "_", "-"))
+		bucket := strings.ToLower(name[i+1:])
+		if bucket != "ip" && bucket != "email" {
+			p.problem(key, "expected RATE_LIMIT_<ROUTE>_<IP|EMAIL>")
+			continue
+		}
+		l, err := ratelimit.ParseLimit(v)
+		if err != nil {
+			p.problem(key, "%v", err)
+			continue
+		}
+		limits[route+":"+bucket] = l
+	}
+	return limits
+}
+
+// categoryRe matches a category of a contact us message.
+var categoryRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// categories parses a list of lower-case categories.
+func (p *parser) categories(key string) []string {
+	xs := p.list(key, nil)
+	for i, c := range xs {
+		xs[i] = strings.ToLower(c)
+		if !categoryRe.MatchString(xs[i]) {
+			p.problem(key, "'%s' is not a valid category", c)
+		}
+	}
+	return xs
+}
+
+// contactUsRoutes parses every CONTACT_US_ROUTE_<CATEGORY> variable, the
+// recipients of the messages of a category, which must be one of the
+// categories.
+func (p *parser) contactUsRoutes(categories []string) map[string][]mail.Address {
+	known := make(map[string]bool)
+	for _, c := range categories {
+		known[c] = true
+	}
+	routes := make(map[string][]mail.Address)
+	for _, key := range sortedKeys(p.vars) {
+		if !strings.HasPrefix(key, "CONTACT_US_ROUTE_") {
+			continue
+		}
+		category := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(key, "CONTACT_US_ROUTE_"), "_", "-"))
+		if !known[category] {
+			p.problem(key, "'%s' is not one of the CONTACT_US_CATEGORIES", category)
+			continue
+		}
+		to := p.addresses(key)
+		if len(to) == 0 {
+			p.problem(key, "required")
+			continue
+		}
+		routes[category] = to
+	}
+	return routes
+}
+
+// emailKeys are the EMAIL_ variables which do not configure a template.
+var emailKeys = map[string]bool{
+	"EMAIL_SERVICE_SCHEME":    true,
+	"EMAIL_SERVICE_HOST":      true,
+	"EMAIL_ARCHIVE_DIR":       true,
+	"EMAIL_FROM":              true,
+	"EMAIL_REPLY_TO":          true,
+	"EMAIL_WEBHOOK_SECRET":    true,
+	"EMAIL_WEBHOOK_TOLERANCE": true,
+}
+
+// emailTemplates parses every EMAIL_<TEMPLATE>_<FIELD> variable, where the
+// field is FROM, REPLY_TO, TO, CC, SUBJECT or SUBJECT_<LOCALE>.
+func (p *parser) emailTemplates() map[string]EmailTemplate {
+	templates := make(map[string]EmailTemplate)
+	keys := make([]string, 0)
+	for key := range p.vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "EMAIL_") || emailKeys[key] {
+			continue
+		}
+		name := strings.TrimPrefix(key, "EMAIL_")
+		field := ""
+		for _, f := range []string{"_REPLY_TO", "_FROM", "_TO", "_CC", "_SUBJECT"} {
+			if strings.HasSuffix(name, f) {
+				field = f[1:]
+				name = strings.TrimSuffix(name, f)
+				break
+			}
+		}
+		locale := ""
+		if i := strings.LastIndex(name, "_SUBJECT_"); field == "" && i > 0 {
+			field = "SUBJECT"
+			locale = strings.ToLower(strings.ReplaceAll(name[i+len("_SUBJECT_"):], "_", "-"))
+			name = name[:i]
+			if !localeRe.MatchString(locale) {
+				p.problem(key, "'%s' is not a valid locale", locale)
+				continue
+			}
+		}
+		if field == "" || name == "" {
+			p.problem(key, "expected EMAIL_<TEMPLATE>_<FROM|REPLY_TO|TO|CC|SUBJECT|SUBJECT_<LOCALE>>")
+			continue
+		}
+
+		template := strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+		t := templates[template]
+		switch field {
+		case "FROM":
+			t.From = p.address(key, true)
+		case "REPLY_TO":
+			t.ReplyTo = p.address(key, true)
+		case "TO":
+			t.To = p.addresses(key)
+		case "CC":
+			t.CC = p.addresses(key)
+		case "SUBJECT":
+			v := strings.TrimSpace(p.vars[key])
+			if locale == "" {
+				t.Subject = v
+				break
+			}
+			if t.Subjects == nil {
+				t.Subjects = make(map[string]string)
+			}
+			t.Subjects[locale] = v
+		}
+		templates[template] = t
+	}
+	return templates
+}
+
+// brandFields are the fields of a BRAND_<NAME>_<FIELD> variable.
+var brandFields = []string{"NAME", "LOGO_URL", "PRIMARY_COLOR", "SECONDARY_COLOR", "FOOTER_LINKS", "SUPPORT", "APP_SCHEME", "APP_HOST", "HOSTS"}
+
+// brands parses every BRAND_<NAME>_<FIELD> variable. The brands link to
+// the application app unless BRAND_<NAME>_APP_SCHEME and _APP_HOST are set
+// and a host may only be of one brand.
+func (p *parser) brands(app Service) map[string]Brand {
+	prefixes := make(map[string]bool)
+	for key := range p.vars {
+		if !strings.HasPrefix(key, "BRAND_") {
+			continue
+		}
+		name := strings.TrimPrefix(key, "BRAND_")
+		ok := false
+		for _, f := range brandFields {
+			if strings.HasSuffix(name, "_"+f) && len(name) > len(f)+1 {
+				prefixes["BRAND_"+strings.TrimSuffix(name, "_"+f)] = true
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			p.problem(key, "expected BRAND_<NAME>_<%s>", strings.Join(brandFields, "|"))
+		}
+	}
+
+	brands := make(map[string]Brand)
+	hosts := make(map[string]string)
+	for _, prefix := range sortedKeys(prefixes) {
+		name := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(prefix, "BRAND_"), "_", "-"))
+		b := Brand{
+			Name:    p.required(prefix + "_NAME"),
+			LogoURL: p.url(prefix + "_LOGO_URL"),
+			Colors: BrandColors{
+				Primary:   p.color(prefix+"_PRIMARY_COLOR", "#369deb"),
+				Secondary: p.color(prefix+"_SECONDARY_COLOR", "#54d6fe"),
+			},
+			FooterLinks: p.links(prefix + "_FOOTER_LINKS"),
+			Support:     p.address(prefix+"_SUPPORT", false),
+			App:         app,
+			Hosts:       p.list(prefix+"_HOSTS", nil),
+		}
+		if strings.TrimSpace(p.vars[prefix+"_APP_HOST"]) != "" {
+			b.App = p.service(prefix + "_APP")
+		}
+		for _, h := range b.Hosts {
+			if other, ok := hosts[h]; ok {
+				p.problem(prefix+"_HOSTS", "host '%s' is also of the brand %s", h, other)
+			}
+			hosts[h] = name
+		}
+		brands[name] = b
+	}
+	return brands
+}
+
+// url parses an optional absolute URL.
+func (p *parser) url(key string) string {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		return v
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.problem(key, "'%s' is not a valid URL", v)
+	}
+	return v
+}
+
+// color parses a hex colour such as "#369deb".
+func (p *parser) color(key string, d string) string {
+	v := strings.TrimSpace(p.vars[key])
+	if v == "" {
+		return d
+	}
+	if !colorRe.MatchString(v) {
+		p.problem(key, "'%s' is not a hex colour", v)
+	}
+	return v
+}
+
+// links parses a comma separated list of links written as "text|url".
+func (p *parser) links(key string) []Link {
+	xl := make([]Link, 0)
+	for _, s := range p.list(key, nil) {
+		xs := strings.SplitN(s, "|", 2)
+		if len(xs) != 2 || strings.TrimSpace(xs[0]) == "" {
+			p.problem(key, "'%s' is not a link, expected text|url", s)
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(xs[1]))
+		if err != nil || u.Scheme == "" {
+			p.problem(key, "'%s' is not a link, expected text|url", s)
+			continue
+		}
+		xl = append(xl, Link{Text: strings.TrimSpace(xs[0]), URL: u.String()})
+	}
+	return xl
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	xs := make([]string, 0, len(m))
+	for k := range m {
+		xs = append(xs, k)
+	}
+	sort.Strings(xs)
+	return xs
+}
+
+// contains reports whether xs contains s.
+func contains(xs []string, s string) bool {
+	for _, x := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+package config
+
+import (
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validVars returns a minimal set of valid configuration variables.
+func validVars(t *testing.T) map[string]string {
+	return map[string]string{
+		"ENV":                     "development",
+		"WORKDIR":                 t.TempDir(),
+		"API_GW_PORT":             "5030",
+		"APP_SCHEME":              "https",
+		"APP_HOST":                "flight-log.dev.dottics.com",
+		"SECURITY_SERVICE_SCHEME": "http",
+		"SECURITY_SERVICE_HOST":   "172.18.1.1:3010",
+		"EMAIL_SERVICE_SCHEME":    "http",
+		"EMAIL_SERVICE_HOST":      "172.18.1.3:3030",
+		"EMAIL_FROM":              "No-Reply Dottics <mail@dottics.com>",
+		"BRAND_FLIGHT_LOG_NAME":   "Flight Log",
+	}
+}
+
+func TestParse(t *testing.T) {
+	vars := validVars(t)
+	vars["CORS_ALLOWED_ORIGINS"] = "https://flight-log.dev.dottics.com, http://localhost:3000"
+	vars["REDIS_ENABLED"] = "true"
+	vars["REDIS_HOST"] = "172.18.1.2:6379"
+	vars["RATE_LIMIT_FORGOT_PASSWORD_EMAIL"] = "3/1h"
+	vars["SERVER_DRAIN_PERIOD"] = "0s"
+	vars["BRAND_FLIGHT_LOG_FOOTER_LINKS"] = "Privacy|https://flight-log.dottics.com/privacy, Terms|https://flight-log.dottics.com/terms"
+	vars["BRAND_FLIGHT_LOG_HOSTS"] = "flight-log.dev.dottics.com"
+	vars["BRAND_BUDGET_NAME"] = "Budget"
+	vars["BRAND_BUDGET_PRIMARY_COLOR"] = "#2bcbba"
+	vars["BRAND_BUDGET_APP_SCHEME"] = "https"
+	vars["BRAND_BUDGET_APP_HOST"] = "budget.dev.dottics.com"
+	vars["BRAND_BUDGET_SUPPORT"] = "Budget Support <budget@dottics.com>"
+	vars["DEFAULT_BRAND"] = "flight-log"
+	vars["CONTACT_US_BLOCKED_KEYWORDS"] = "Casino, SEO services"
+	vars["EMAIL_WEBHOOK_SECRET"] = " s3cret "
+	vars["CONTACT_US_CATEGORIES"] = "account, Logbook, billing"
+	vars["CONTACT_US_ROUTE_BILLING"] = "Dottics Billing <billing@dottics.com>"
+	vars["EMAIL_CONTACT_US_TO"] = "Dottics Team <howzit@dottics.com>, js@dottics.com"
+	vars["EMAIL_FORGOT_PASSWORD_REPLY_TO"] = "support@dottics.com"
+	vars["EMAIL_FORGOT_PASSWORD_SUBJECT_DE_CH"] = "Passwort vergessen"
+
+	c, err := Parse(vars)
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	if c.Port != 5030 {
+		t.Errorf("expected port %d got %d", 5030, c.Port)
+	}
+	u := c.App.URL("/reset-password")
+	if u.String() != "https://flight-log.dev.dottics.com/reset-password" {
+		t.Errorf("expected app url '%s' got '%s'", "https://flight-log.dev.dottics.com/reset-password", u.String())
+	}
+	if len(c.CORS.AllowedOrigins) != 2 || c.CORS.AllowedOrigins[1] != "http://localhost:3000" {
+		t.Errorf("expected allowed origins got %v", c.CORS.AllowedOrigins)
+	}
+	if !c.Redis.Enabled || c.Redis.Host != "172.18.1.2:6379" {
+		t.Errorf("expected redis enabled on %s got %v", "172.18.1.2:6379", c.Redis)
+	}
+	l := c.RateLimit.Limits["forgot-password:email"]
+	if l != (ratelimit.Limit{Requests: 3, Window: time.Hour}) {
+		t.Errorf("expected forgot-password email limit 3/1h got %v", l)
+	}
+	if c.Timeouts.Drain != 0 {
+		t.Errorf("expected drain period %v got %v", time.Duration(0), c.Timeouts.Drain)
+	}
+	if c.Timeouts.Write != 30*time.Second {
+		t.Errorf("expected default write timeout %v got %v", 30*time.Second, c.Timeouts.Write)
+	}
+	if c.DefaultLocale != "en" {
+		t.Errorf("expected default locale '%s' got '%s'", "en", c.DefaultLocale)
+	}
+	if c.Outbox.Dir != "" || c.Outbox.Workers != 4 || c.Outbox.MaxAttempts != 8 {
+		t.Errorf("expected the default outbox got %v", c.Outbox)
+	}
+	if len(c.AdminPermissionCodes) != 1 || c.AdminPermissionCodes[0] != "admin" {
+		t.Errorf("expected admin permission codes %v got %v", []string{"admin"}, c.AdminPermissionCodes)
+	}
+	if c.EmailArchiveDir != "" {
+		t.Errorf("expected email archive disabled got '%s'", c.EmailArchiveDir)
+	}
+	if c.Email.From.Name != "No-Reply Dottics" || c.Email.From.Address != "mail@dottics.com" {
+		t.Errorf("expected email from %v got %v", "No-Reply Dottics <mail@dottics.com>", c.Email.From)
+	}
+	if to := c.Email.Templates["contact-us"].To; len(to) != 2 || to[1].Address != "js@dottics.com" {
+		t.Errorf("expected contact-us to %v got %v", "[howzit@dottics.com js@dottics.com]", to)
+	}
+	if c.Email.WebhookSecret != "s3cret" || len(c.Email.Templates) != 2 {
+		t.Errorf("expected the webhook secret %s and %d templates got %s and %v", "s3cret", 2, c.Email.WebhookSecret, c.Email.Templates)
+	}
+	if c.Email.WebhookTolerance != 5*time.Minute {
+		t.Errorf("expected the webhook tolerance %s got %s", 5*time.Minute, c.Email.WebhookTolerance)
+	}
+	fp := c.Email.Templates["forgot-password"]
+	if fp.ReplyTo.Address != "support@dottics.com" || fp.Subjects["de-ch"] != "Passwort vergessen" {
+		t.Errorf("expected the forgot-password reply-to and de-ch subject got %v", fp)
+	}
+	if c.DefaultBrand != "flight-log" || len(c.Brands) != 2 {
+		t.Errorf("expected the default brand %s of %d brands got %s of %v", "flight-log", 2, c.DefaultBrand, c.Brands)
+	}
+	fl := c.Brands["flight-log"]
+	if fl.Name != "Flight Log" || fl.App != c.App || fl.Colors.Primary != "#369deb" || len(fl.Hosts) != 1 {
+		t.Errorf("expected the flight-log brand with the defaults got %v", fl)
+	}
+	if len(fl.FooterLinks) != 2 || fl.FooterLinks[1] != (Link{Text: "Terms", URL: "https://flight-log.dottics.com/terms"}) {
+		t.Errorf("expected the flight-log footer links got %v", fl.FooterLinks)
+	}
+	b := c.Brands["budget"]
+	if b.App.Host != "budget.dev.dottics.com" || b.Colors.Primary != "#2bcbba" || b.Support.Address != "budget@dottics.com" {
+		t.Errorf("expected the budget brand got %v", b)
+	}
+	if c.ContactUs.MessageMaxLength != 5000 || c.ContactUs.MinSubmitTime != 3*time.Second || !c.ContactUs.Acknowledge {
+		t.Errorf("expected the default contact us validation got %v", c.ContactUs)
+	}
+	if !c.ForgotPassword.EnumerationSafe || c.ForgotPassword.MinDuration != time.Second {
+		t.Errorf("expected the default enumeration safe forgot password got %v", c.ForgotPassword)
+	}
+	if c.VerifyEmail.Secret != "" || c.VerifyEmail.LinkTTL != 24*time.Hour {
+		t.Errorf("expected registration disabled with a link ttl of %s got %v", 24*time.Hour, c.VerifyEmail)
+	}
+	if fmt.Sprint(c.ContactUs.BlockedKeywords) != "[casino seo services]" {
+		t.Errorf("expected blocked keywords %v got %v", "[casino seo services]", c.ContactUs.BlockedKeywords)
+	}
+	if fmt.Sprint(c.ContactUs.Categories) != "[account logbook billing]" {
+		t.Errorf("expected categories %v got %v", "[account logbook billing]", c.ContactUs.Categories)
+	}
+	if to := c.ContactUs.Routes["billing"]; len(c.ContactUs.Routes) != 1 || len(to) != 1 || to[0].Address != "billing@dottics.com" {
+		t.Errorf("expected the billing route to %v got %v", "billing@dottics.com", c.ContactUs.Routes)
+	}
+	if c.SessionCache.TTL != 5*time.Minute {
+		t.Errorf("expected default session cache ttl %v got %v", 5*time.Minute, c.SessionCache.TTL)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		problem string
+	}{
+		{name: "missing env", key: "ENV", value: "", problem: "ENV: required, one of local, development, staging, production"},
+		{name: "unknown env", key: "ENV", value: "prod", problem: "ENV: 'prod' must be one of local, development, staging, production"},
+		{name: "missing workdir", key: "WORKDIR", value: "", problem: "WORKDIR: required"},
+		{name: "workdir not a directory", key: "WORKDIR", value: "/does/not/exist", problem: "WORKDIR: '/does/not/exist' is not a directory"},
+		{name: "invalid default locale", key: "DEFAULT_LOCALE", value: "English", problem: "DEFAULT_LOCALE: 'English' is not a valid locale"},
+		{name: "email archive not a directory", key: "EMAIL_ARCHIVE_DIR", value: "/does/not/exist", problem: "EMAIL_ARCHIVE_DIR: '/does/not/exist' is not a directory"},
+		{name: "missing email sender", key: "EMAIL_FROM", value: "", problem: "EMAIL_FROM: required"},
+		{name: "invalid email sender", key: "EMAIL_FROM", value: "mail at dottics", problem: "EMAIL_FROM: 'mail at dottics' is not a valid address"},
+		{name: "invalid email recipients", key: "EMAIL_CONTACT_US_TO", value: "howzit@dottics.com; js@dottics.com", problem: "EMAIL_CONTACT_US_TO: 'howzit@dottics.com; js@dottics.com' is not a valid address list"},
+		{name: "unknown email field", key: "EMAIL_CONTACT_US_BCC", value: "js@dottics.com", problem: "EMAIL_CONTACT_US_BCC: expected EMAIL_<TEMPLATE>_<FROM|REPLY_TO|TO|CC|SUBJECT|SUBJECT_<LOCALE>>"},
+		{name: "missing brand name", key: "BRAND_FLIGHT_LOG_NAME", value: "", problem: "BRAND_FLIGHT_LOG_NAME: required"},
+		{name: "unknown default brand", key: "DEFAULT_BRAND", value: "budget", problem: "DEFAULT_BRAND: 'budget' must be one of flight-log"},
+		{name: "invalid brand colour", key: "BRAND_FLIGHT_LOG_PRIMARY_COLOR", value: "blue", problem: "BRAND_FLIGHT_LOG_PRIMARY_COLOR: 'blue' is not a hex colour"},
+		{name: "invalid brand logo", key: "BRAND_FLIGHT_LOG_LOGO_URL", value: "logo.png", problem: "BRAND_FLIGHT_LOG_LOGO_URL: 'logo.png' is not a valid URL"},
+		{name: "invalid footer link", key: "BRAND_FLIGHT_LOG_FOOTER_LINKS", value: "Privacy", problem: "BRAND_FLIGHT_LOG_FOOTER_LINKS: 'Privacy' is not a link, expected text|url"},
+		{name: "unknown brand field", key: "BRAND_FLIGHT_LOG_COLOUR", value: "#fff", problem: "BRAND_FLIGHT_LOG_COLOUR: expected BRAND_<NAME>_<NAME|LOGO_URL|PRIMARY_COLOR|SECONDARY_COLOR|FOOTER_LINKS|SUPPORT|APP_SCHEME|APP_HOST|HOSTS>"},
+		{name: "outbox workers out of range", key: "OUTBOX_WORKERS", value: "0", problem: "OUTBOX_WORKERS: 0 is not in the range 1 to 64"},
+		{name: "outbox backoff max below base", key: "OUTBOX_BACKOFF_MAX", value: "1s", problem: "OUTBOX_BACKOFF_MAX: 1s must be at least OUTBOX_BACKOFF_BASE 10s"},
+		{name: "missing port", key: "API_GW_PORT", value: "", problem: "API_GW_PORT: required"},
+		{name: "port not an integer", key: "API_GW_PORT", value: "http", problem: "API_GW_PORT: 'http' is not an integer"},
+		{name: "port out of range", key: "API_GW_PORT", value: "70000", problem: "API_GW_PORT: 70000 is not in the range 1 to 65535"},
+		{name: "invalid scheme", key: "APP_SCHEME", value: "ftp", problem: "APP_SCHEME: 'ftp' must be one of http, https"},
+		{name: "host with path", key: "APP_HOST", value: "dottics.com/app", problem: "APP_HOST: 'dottics.com/app' is not a valid host"},
+		{name: "host with invalid port", key: "SECURITY_SERVICE_HOST", value: "172.18.1.1:0", problem: "SECURITY_SERVICE_HOST: '172.18.1.1:0' has an invalid port"},
+		{name: "invalid origin", key: "CORS_ALLOWED_ORIGINS", value: "dottics.com", problem: "CORS_ALLOWED_ORIGINS: 'dottics.com' is not a valid origin"},
+		{name: "invalid boolean", key: "REDIS_ENABLED", value: "yes please", problem: "REDIS_ENABLED: 'yes please' is not a boolean"},
+		{name: "invalid duration", key: "SERVER_WRITE_TIMEOUT", value: "30", problem: "SERVER_WRITE_TIMEOUT: '30' is not a duration"},
+		{name: "invalid rate limit", key: "RATE_LIMIT_LOGIN_IP", value: "many/1m", problem: "RATE_LIMIT_LOGIN_IP: invalid limit 'many/1m' requests must be a positive integer"},
+		{name: "invalid contact us category", key: "CONTACT_US_CATEGORIES", value: "account,logbook data", problem: "CONTACT_US_CATEGORIES: 'logbook data' is not a valid category"},
+		{name: "unknown contact us route", key: "CONTACT_US_ROUTE_SALES", value: "sales@dottics.com", problem: "CONTACT_US_ROUTE_SALES: 'sales' is not one of the CONTACT_US_CATEGORIES"},
+		{name: "invalid rate limit bucket", key: "RATE_LIMIT_LOGIN_USER", value: "5/1m", problem: "RATE_LIMIT_LOGIN_USER: expected RATE_LIMIT_<ROUTE>_<IP|EMAIL>"},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			vars := validVars(t)
+			vars[tc.key] = tc.value
+
+			_, err := Parse(vars)
+			ve, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("expected a validation error got %v", err)
+			}
+			if len(ve.Problems) != 1 || ve.Problems[0] != tc.problem {
+				t.Errorf("expected problems %v got %v", []string{tc.problem}, ve.Problems)
+			}
+		})
+	}
+}
+
+func TestParse_CORSCredentials(t *testing.T) {
+	vars := validVars(t)
+	vars["CORS_ALLOWED_ORIGINS"] = "*"
+	vars["CORS_ALLOW_CREDENTIALS"] = "true"
+
+	_, err := Parse(vars)
+	ve, ok := err.(*ValidationError)
+	problem := "CORS_ALLOW_CREDENTIALS: credentials may not be allowed with the CORS_ALLOWED_ORIGINS *"
+	if !ok || len(ve.Problems) != 1 || ve.Problems[0] != problem {
+		t.Errorf("expected problems %v got %v", []string{problem}, err)
+	}
+}
+
+func TestParse_Report(t *testing.T) {
+	_, err := Parse(map[string]string{"REDIS_ENABLED": "true"})
+	if err == nil {
+		t.Fatalf("expected a validation error")
+	}
+	// every problem is reported, not only the first
+	for _, key := range []string{"ENV", "WORKDIR", "API_GW_PORT", "APP_HOST", "EMAIL_SERVICE_SCHEME", "REDIS_HOST"} {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("expected the report to contain %s got\n%s", key, err.Error())
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	name := path.Join(dir, ".env")
+	content := "# gateway\nENV=development\nWORKDIR=/does/not/exist\nAPI_GW_PORT=5030\n\n" +
+		"APP_SCHEME=https\nAPP_HOST=flight-log.dev.dottics.com\n" +
+		"SECURITY_SERVICE_SCHEME=http\nSECURITY_SERVICE_HOST=172.18.1.1:3010\n" +
+		"EMAIL_SERVICE_SCHEME=http\nEMAIL_SERVICE_HOST=172.18.1.3:3030\n" +
+		"EMAIL_FROM=No-Reply Dottics <mail@dottics.com>\nBRAND_FLIGHT_LOG_NAME=Flight Log\n" +
+		"HEALTH_PROBE_TIMEOUT=1s\nCORS_ALLOWED_ORIGINS=https://flight-log.dev.dottics.com\n"
+	err := os.WriteFile(name, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the process environment overrides the .env file
+	t.Setenv("HEALTH_PROBE_TIMEOUT", "3s")
+	// the flags override the environment
+	t.Setenv("API_GW_PORT", "5031")
+	// the variables of the environment which do not configure the gateway
+	// are ignored
+	t.Setenv("EMAIL_HOST_PASSWORD", "s3cret")
+	t.Setenv("BRAND_COLOR", "red")
+	args := []string{"-env-file", name, "-workdir", dir, "-port", "5032"}
+
+	c, err := Load(args)
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	if c.WorkDir != dir {
+		t.Errorf("expected workdir '%s' got '%s'", dir, c.WorkDir)
+	}
+	if c.Port != 5032 {
+		t.Errorf("expected port %d got %d", 5032, c.Port)
+	}
+	if c.HealthProbeTimeout != 3*time.Second {
+		t.Errorf("expected health probe timeout %v got %v", 3*time.Second, c.HealthProbeTimeout)
+	}
+	if c.CORS.AllowedOrigins[0] != "https://flight-log.dev.dottics.com" {
+		t.Errorf("expected allowed origins from the .env file got %v", c.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoad_EnvFiles(t *testing.T) {
+	wd, _ := os.Getwd()
+	for _, name := range []string{".env.local", ".env.development"} {
+		t.Run(name, func(t *testing.T) {
+			args := []string{"-env-file", path.Join(wd, "../..", name), "-workdir", t.TempDir()}
+			_, err := Load(args)
+			if err != nil {
+				t.Errorf("expected the %s configuration to be valid got %v", name, err)
+			}
+		})
+	}
+}
+
+func TestKnownKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		known bool
+	}{
+		{key: "HEALTH_PROBE_TIMEOUT", known: true},
+		{key: "RATE_LIMIT_FORGOT_PASSWORD_EMAIL", known: true},
+		{key: "RATE_LIMIT_FORGOT_PASSWORD", known: false},
+		{key: "CONTACT_US_ROUTE_BILLING", known: true},
+		{key: "BRAND_FLIGHT_LOG_PRIMARY_COLOR", known: true},
+		{key: "BRAND_COLOR", known: false},
+		{key: "EMAIL_CONTACT_US_TO", known: true},
+		{key: "EMAIL_FORGOT_PASSWORD_SUBJECT_DE_CH", known: true},
+		{key: "EMAIL_HOST_PASSWORD", known: false},
+		{key: "PATH", known: false},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.key)
+		t.Run(name, func(t *testing.T) {
+			if knownKey(tc.key) != tc.known {
+				t.Errorf("expected known %v", tc.known)
+			}
+		})
+	}
+
+	// every variable of the env files is known
+	wd, _ := os.Getwd()
+	for _, name := range []string{".env.local", ".env.development"} {
+		vars, err := ReadEnvFile(path.Join(wd, "../..", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key := range vars {
+			if !knownKey(key) {
+				t.Errorf("expected %s of %s to be known", key, name)
+			}
+		}
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	name := path.Join(t.TempDir(), ".env")
+	_ = os.WriteFile(name, []byte("A=1\nB=x=y\nC\n"), 0644)
+	_, err := ReadEnvFile(name)
+	if err == nil || !strings.Contains(err.Error(), ":3: expected KEY=VALUE") {
+		t.Errorf("expected a line 3 error got %v", err)
+	}
+
+	_ = os.WriteFile(name, []byte("A=1\nB=x=y\n"), 0644)
+	vars, err := ReadEnvFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["B"] != "x=y" {
+		t.Errorf("expected value '%s' got '%s'", "x=y", vars["B"])
+	}
+
+	vars, err = ReadEnvFile(path.Join(t.TempDir(), "missing.env"))
+	if err != nil || len(vars) != 0 {
+		t.Errorf("expected a missing file to be empty got %v %v", vars, err)
+	}
+}
@@ -0,0 +1,150 @@
+package src
+
+import (
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORS is the Cross-Origin Resource Sharing policy which is applied to
+// every route registered on the Server.
+type CORS struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+// NewCORS creates the CORS policy from the configuration.
+func NewCORS(c config.CORS) *CORS {
+	return &CORS{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// AllowOrigin reports whether a request from the origin is allowed.
+func (c *CORS) AllowOrigin(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowMethod reports whether the method may be used in a cross-origin
+// request.
+func (c *CORS) AllowMethod(method string) bool {
+	for _, m := range c.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// setHeaders replaces any Access-Control-* headers on h with the headers
+// of the policy for the origin. The preflight headers are only set when
+// preflight is true.
+func (c *CORS) setHeaders(h http.Header, origin string, preflight bool) {
+	for key := range h {
+		if strings.HasPrefix(key, "Access-Control-") {
+			h.Del(key)
+		}
+	}
+	h.Add("Vary", "Origin")
+	if origin == "" || !c.AllowOrigin(origin) {
+		return
+	}
+
+	if len(c.AllowedOrigins) == 1 && c.AllowedOrigins[0] == "*" && !c.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(c.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+	}
+	if preflight {
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+		h.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+		}
+	}
+}
+
+// corsWriter is a http.ResponseWriter which applies the CORS policy to
+// the headers just before they are written. This is required because
+// dutil.Resp sets its own Access-Control-* headers when responding.
+type corsWriter struct {
+	http.ResponseWriter
+	cors        *CORS
+	origin      string
+	preflight   bool
+	wroteHeader bool
+}
+
+func (cw *corsWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.cors.setHeaders(cw.Header(), cw.origin, cw.preflight)
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *corsWriter) Write(xb []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(xb)
+}
+
+// Handler applies the CORS policy to the handler function f. Pre-flight
+// requests are answered directly and requests from origins which are not
+// allowed are rejected with a 403.
+func (c *CORS) Handler(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+		cw := &corsWriter{
+			ResponseWriter: w,
+			cors:           c,
+			origin:         origin,
+			preflight:      preflight,
+		}
+
+		if origin != "" && !c.AllowOrigin(origin) {
+			e := dutil.NewErr(403, "cors", []string{"origin not allowed"})
+			handler.Error(cw, r, e)
+			return
+		}
+		if preflight && !c.AllowMethod(r.Header.Get("Access-Control-Request-Method")) {
+			e := dutil.NewErr(403, "cors", []string{"method not allowed"})
+			handler.Error(cw, r, e)
+			return
+		}
+		if r.Method == "OPTIONS" {
+			resp := dutil.Resp{
+				Status:  200,
+				Message: "Pre-Flight Allowed",
+			}
+			resp.Respond(cw, r)
+			return
+		}
+		f(cw, r)
+	}
+}
@@ -0,0 +1,175 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/johannesscr/micro/microtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewCORS(t *testing.T) {
+	c := NewCORS(config.CORS{
+		AllowedOrigins:   []string{"https://a.dottics.com", "https://b.dottics.com"},
+		ExposedHeaders:   []string{"X-Token"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})
+	if len(c.AllowedOrigins) != 2 || c.AllowedOrigins[1] != "https://b.dottics.com" {
+		t.Errorf("expected allowed origins %v got %v", []string{"https://a.dottics.com", "https://b.dottics.com"}, c.AllowedOrigins)
+	}
+	if !c.AllowCredentials {
+		t.Errorf("expected allow credentials %v got %v", true, c.AllowCredentials)
+	}
+	if c.MaxAge != 600 {
+		t.Errorf("expected max age %d got %d", 600, c.MaxAge)
+	}
+	if len(c.ExposedHeaders) != 1 || c.ExposedHeaders[0] != "X-Token" {
+		t.Errorf("expected exposed headers %v got %v", []string{"X-Token"}, c.ExposedHeaders)
+	}
+}
+
+func TestCORS_Handler(t *testing.T) {
+	type E struct {
+		status      int
+		data        string
+		origin      string
+		methods     string
+		exposed     string
+		credentials string
+		maxAge      string
+	}
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string][]string
+		E       E
+	}{
+		{
+			name:   "pre-flight allowed",
+			method: "OPTIONS",
+			headers: map[string][]string{
+				"Origin":                        {"https://flight-log.dottics.com"},
+				"Access-Control-Request-Method": {"POST"},
+			},
+			E: E{
+				status:      200,
+				data:        `{"message":"Pre-Flight Allowed","data":null,"errors":null}`,
+				origin:      "https://flight-log.dottics.com",
+				methods:     "OPTIONS, GET, POST",
+				exposed:     "X-Token",
+				credentials: "true",
+				maxAge:      "600",
+			},
+		},
+		{
+			name:   "pre-flight origin not allowed",
+			method: "OPTIONS",
+			headers: map[string][]string{
+				"Origin":                        {"https://evil.com"},
+				"Access-Control-Request-Method": {"POST"},
+			},
+			E: E{
+				status: 403,
+				data:   `{"message":"Forbidden","data":null,"errors":{"cors":["origin not allowed"]}}`,
+			},
+		},
+		{
+			name:   "pre-flight method not allowed",
+			method: "OPTIONS",
+			headers: map[string][]string{
+				"Origin":                        {"https://flight-log.dottics.com"},
+				"Access-Control-Request-Method": {"DELETE"},
+			},
+			E: E{
+				status:      403,
+				data:        `{"message":"Forbidden","data":null,"errors":{"cors":["method not allowed"]}}`,
+				origin:      "https://flight-log.dottics.com",
+				methods:     "OPTIONS, GET, POST",
+				exposed:     "X-Token",
+				credentials: "true",
+				maxAge:      "600",
+			},
+		},
+		{
+			name:   "request allowed",
+			method: "POST",
+			headers: map[string][]string{
+				"Origin": {"https://flight-log.dottics.com"},
+			},
+			E: E{
+				status:      200,
+				data:        `{"message":"handled","data":null,"errors":null}`,
+				origin:      "https://flight-log.dottics.com",
+				exposed:     "X-Token",
+				credentials: "true",
+			},
+		},
+		{
+			name:   "request origin not allowed",
+			method: "POST",
+			headers: map[string][]string{
+				"Origin": {"https://evil.com"},
+			},
+			E: E{
+				status: 403,
+				data:   `{"message":"Forbidden","data":null,"errors":{"cors":["origin not allowed"]}}`,
+			},
+		},
+		{
+			name:    "request without origin",
+			method:  "POST",
+			headers: map[string][]string{},
+			E: E{
+				status: 200,
+				data:   `{"message":"handled","data":null,"errors":null}`,
+			},
+		},
+	}
+
+	c := &CORS{
+		AllowedOrigins:   []string{"https://flight-log.dottics.com"},
+		AllowedMethods:   []string{"OPTIONS", "GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "X-Token"},
+		ExposedHeaders:   []string{"X-Token"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}
+	f := c.Handler(func(w http.ResponseWriter, r *http.Request) {
+		resp := dutil.Resp{Status: 200, Message: "handled"}
+		resp.Respond(w, r)
+	})
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			req := microtest.NewRequest(tc.method, "/", nil, tc.headers, nil)
+			rec := httptest.NewRecorder()
+			f(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+			h := map[string]string{
+				"Access-Control-Allow-Origin":      tc.E.origin,
+				"Access-Control-Allow-Methods":     tc.E.methods,
+				"Access-Control-Expose-Headers":    tc.E.exposed,
+				"Access-Control-Allow-Credentials": tc.E.credentials,
+				"Access-Control-Max-Age":           tc.E.maxAge,
+			}
+			for key, value := range h {
+				if res.Header.Get(key) != value {
+					t.Errorf("expected header %s '%s' got '%s'", key, value, res.Header.Get(key))
+				}
+			}
+		})
+	}
+}
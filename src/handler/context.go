@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"context"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"net/http"
+)
+
+type contextKey string
+
+const sessionKey contextKey = "session"
+
+// WithSession returns a shallow copy of the request r with the
+// authenticated session attached to the request's context.
+func WithSession(r *http.Request, s includes.Session) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionKey, s)
+	return r.WithContext(ctx)
+}
+
+// SessionFrom returns the authenticated session attached to the request r
+// by the authentication middleware. The boolean is false if the request
+// has not been authenticated.
+func SessionFrom(r *http.Request) (includes.Session, bool) {
+	s, ok := r.Context().Value(sessionKey).(includes.Session)
+	return s, ok
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	security "github.com/dottics/securityserv"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionFrom(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	_, ok := SessionFrom(req)
+	if ok {
+		t.Errorf("expected no session on an unauthenticated request")
+	}
+
+	s := includes.Session{
+		Token:           "my-token",
+		User:            security.User{Email: "james@bond.com"},
+		PermissionCodes: security.PermissionCodes{"aio2"},
+	}
+	req = WithSession(req, s)
+	session, ok := SessionFrom(req)
+	if !ok {
+		t.Errorf("expected session on an authenticated request")
+	}
+	if session.Token != s.Token {
+		t.Errorf("expected token '%s' got '%s'", s.Token, session.Token)
+	}
+	if session.User.Email != s.User.Email {
+		t.Errorf("expected user email '%s' got '%s'", s.User.Email, session.User.Email)
+	}
+	if len(session.PermissionCodes) != 1 || session.PermissionCodes[0] != "aio2" {
+		t.Errorf("expected permission codes %v got %v", s.PermissionCodes, session.PermissionCodes)
+	}
+}
@@ -2,17 +2,41 @@ package handler
 
 import (
 	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/audit"
+	"github.com/dottics/flight-log-api-gateway/src/config"
 	"github.com/dottics/flight-log-api-gateway/src/includes"
 	security "github.com/dottics/securityserv"
+	"github.com/google/uuid"
+	"log"
 	"net/http"
 	"net/mail"
+	"strings"
+	"time"
 )
 
+// locale resolves the locale of an email from the explicit locale of the
+// payload followed by the Accept-Language of the request.
+func locale(r *http.Request, explicit string) string {
+	preferences := []string{explicit}
+	preferences = append(preferences, includes.ParseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+	return includes.ResolveLocale(preferences...)
+}
+
+// brand resolves the brand of an email from the host of the request.
+func brand(r *http.Request) config.Brand {
+	return includes.ResolveBrand(r.Host)
+}
+
 // ForgotPassword handles the generation of the forgot password email
-// and exchanges with the email microservice to send the email.
+// and exchanges with the email microservice to send the email. When the
+// flow is enumeration safe a request for an email without a user is
+// recorded, a failure to send the email is logged, and either receives the
+// same response as any other request, which is delayed to take at least
+// the minimum duration of the flow.
 func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	// decode the request json body
-	p := security.PasswordResetTokenPayload{}
+	p := includes.ForgotPasswordPayload{}
 	e := dutil.Decode(w, r, &p)
 	if e != nil {
 		Error(w, r, e)
@@ -20,26 +44,50 @@ func ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// generate the password reset token
-	t, e := includes.PasswordResetToken(p)
+	t, e := includes.PasswordResetToken(security.PasswordResetTokenPayload{Email: p.Email})
+	if e != nil && includes.EnumerationSafe() && includes.UserNotFound(e) {
+		log.Printf("forgot-password: no user with the email %s", includes.MaskEmail(p.Email))
+		includes.RecordEvent(r.Context(), audit.Event{
+			Type:         audit.PasswordResetUnknownAccount,
+			Email:        strings.ToLower(strings.TrimSpace(p.Email)),
+			RemoteAddr:   r.RemoteAddr,
+			ForwardedFor: r.Header.Get("X-Forwarded-For"),
+			UserAgent:    r.UserAgent(),
+			Time:         time.Now().UTC(),
+		})
+		forgotPasswordSent(w, r, start)
+		return
+	}
 	if e != nil {
 		Error(w, r, e)
 		return
 	}
 
 	to := mail.Address{Address: p.Email}
-	msg := includes.NewForgotPasswordMsg(to, t)
+	msg := includes.NewForgotPasswordMsg(to, t, locale(r, p.Locale), brand(r))
 	e = msg.ExecuteTemplate()
 	if e != nil {
 		Error(w, r, e)
 		return
 	}
 
-	e = includes.SendForgotPassword(*msg)
+	e = msg.SendMail()
+	if e != nil && includes.EnumerationSafe() {
+		log.Printf("forgot-password: not sent to %s: %v", includes.MaskEmail(p.Email), e)
+		e = nil
+	}
 	if e != nil {
 		Error(w, r, e)
 		return
 	}
 
+	forgotPasswordSent(w, r, start)
+}
+
+// forgotPasswordSent responds that the forgot password email is sent once
+// the minimum duration of the forgot password flow since start has passed.
+func forgotPasswordSent(w http.ResponseWriter, r *http.Request, start time.Time) {
+	includes.PadForgotPassword(r.Context(), start)
 	resp := dutil.Resp{
 		Status:  200,
 		Message: "forgot password email sent successfully",
@@ -47,9 +95,146 @@ func ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	resp.Respond(w, r)
 }
 
+// RevokePassword handles the revocation of a password reset token which
+// the forgot password email links to. The token is revoked with the
+// security microservice, the revocation is recorded and the owner of the
+// token, as returned by the security microservice, is notified. A failed
+// notification does not fail the request.
+func RevokePassword(w http.ResponseWriter, r *http.Request) {
+	p := includes.RevokePasswordPayload{}
+	e := dutil.Decode(w, r, &p)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	t, err := uuid.Parse(strings.TrimSpace(p.PasswordResetToken))
+	if strings.TrimSpace(p.PasswordResetToken) == "" {
+		e := dutil.NewErr(400, "password_reset_token", []string{"required"})
+		Error(w, r, e)
+		return
+	} else if err != nil {
+		e := dutil.NewErr(400, "password_reset_token", []string{"invalid token"})
+		Error(w, r, e)
+		return
+	}
+
+	user, e := includes.RevokePasswordResetToken(t)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+	includes.RecordEvent(r.Context(), audit.Event{
+		Type:         audit.PasswordResetRevoked,
+		Email:        strings.ToLower(strings.TrimSpace(user.Email)),
+		RemoteAddr:   r.RemoteAddr,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		UserAgent:    r.UserAgent(),
+		Time:         time.Now().UTC(),
+	})
+
+	to, err := mail.ParseAddress(strings.TrimSpace(user.Email))
+	if err != nil {
+		log.Printf("revoke-password: unable to notify the owner of the account: %v", err)
+	} else {
+		msg := includes.NewPasswordResetRevokedMsg(mail.Address{Address: to.Address}, locale(r, p.Locale), brand(r))
+		e = msg.ExecuteTemplate()
+		if e == nil {
+			e = msg.SendMail()
+		}
+		if e != nil {
+			log.Printf("revoke-password: unable to notify the owner of the account: %v", e)
+		}
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "password reset revoked",
+	}
+	resp.Respond(w, r)
+}
+
+// ChangePassword handles the change of the password of the authenticated
+// user. The security microservice verifies the current password, the
+// change is recorded and the user is notified so that a change which was
+// not made by the user can be reported. A failed notification does not
+// fail the request.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	session, ok := SessionFrom(r)
+	if !ok {
+		e := dutil.NewErr(401, "authentication", []string{"token required", "please login"})
+		Error(w, r, e)
+		return
+	}
+
+	p := includes.ChangePasswordPayload{}
+	e := dutil.Decode(w, r, &p)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	errs := make(map[string][]string)
+	if p.CurrentPassword == "" {
+		errs["current_password"] = []string{"required"}
+	}
+	if p.NewPassword == "" {
+		errs["new_password"] = []string{"required"}
+	} else if p.NewPassword == p.CurrentPassword {
+		errs["new_password"] = []string{"must differ from the current password"}
+	}
+	if len(errs) > 0 {
+		e := &dutil.Err{
+			Status: 400,
+			Errors: errs,
+		}
+		Error(w, r, e)
+		return
+	}
+
+	e = includes.ChangePassword(session.Token, p)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+	changedAt := time.Now().UTC()
+	includes.RecordEvent(r.Context(), audit.Event{
+		Type:         audit.PasswordChanged,
+		Email:        strings.ToLower(session.User.Email),
+		RemoteAddr:   r.RemoteAddr,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		UserAgent:    r.UserAgent(),
+		Time:         changedAt,
+	})
+
+	to := mail.Address{Name: strings.TrimSpace(session.User.FirstName + " " + session.User.LastName), Address: session.User.Email}
+	msg := includes.NewPasswordChangedMsg(to, changedAt, locale(r, p.Locale), brand(r))
+	e = msg.ExecuteTemplate()
+	if e == nil {
+		e = msg.SendMail()
+	}
+	if e != nil {
+		log.Printf("change-password: unable to notify the owner of the account: %v", e)
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "password changed successfully",
+	}
+	resp.Respond(w, r)
+}
+
+// contactUsMaxBytes limits the size of the contact-us request body.
+const contactUsMaxBytes = 64 << 10
+
 // ContactUs handles the generation of the contact-us email and exchanges
-// with the email microservice to send the contact-us email.
+// with the email microservice to send the contact-us email. The payload is
+// sanitized and validated first, a submission which fills out the
+// honeypot is acknowledged but not sent so that bots do not learn of the
+// honeypot. Once the email to the team is sent the sender receives an
+// acknowledgement, a failed acknowledgement does not fail the request.
 func ContactUs(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, contactUsMaxBytes)
 	msgData := includes.ContactUsMsgPayload{}
 	e := dutil.Decode(w, r, &msgData)
 	if e != nil {
@@ -57,11 +242,27 @@ func ContactUs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	replyTo := mail.Address{
-		Name:    msgData.Name,
-		Address: msgData.Email,
+	msgData.Sanitize()
+	if msgData.Honeypot() {
+		log.Printf("contact-us: dropped a submission which filled out the honeypot")
+		resp := dutil.Resp{
+			Status:  200,
+			Message: "contact-us email sent successfully",
+		}
+		resp.Respond(w, r)
+		return
 	}
-	msg := includes.NewContactUsMsg(replyTo, msgData.Message)
+	errs := msgData.Validate()
+	if len(errs) > 0 {
+		e := &dutil.Err{
+			Status: 400,
+			Errors: errs,
+		}
+		Error(w, r, e)
+		return
+	}
+
+	msg := includes.NewContactUsMsg(&msgData, locale(r, msgData.Locale), brand(r))
 	e = msg.ExecuteTemplate()
 	if e != nil {
 		Error(w, r, e)
@@ -72,6 +273,10 @@ func ContactUs(w http.ResponseWriter, r *http.Request) {
 		Error(w, r, e)
 		return
 	}
+	_, e = includes.AcknowledgeContactUs(r.Context(), msgData.Sender(), msg.Locale, brand(r))
+	if e != nil {
+		log.Printf("contact-us: unable to acknowledge the message: %v", e)
+	}
 
 	resp := dutil.Resp{
 		Status:  200,
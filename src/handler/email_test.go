@@ -2,19 +2,35 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/audit"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	security "github.com/dottics/securityserv"
 	"github.com/johannesscr/micro/microtest"
 	"io"
 	"net/http/httptest"
+	"net/mail"
 	"os"
 	"path"
 	"strings"
 	"testing"
+	"time"
 )
 
+// testEmail is the email configuration of the tests.
+var testEmail = config.Email{
+	From: mail.Address{Name: "No-Reply Dottics", Address: "mail@dottics.com"},
+	Templates: map[string]config.EmailTemplate{
+		"contact-us": {To: []mail.Address{{Name: "Dottics Team", Address: "howzit@dottics.com"}}},
+	},
+}
+
 func TestForgotPassword(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
 
 	type E struct {
 		status int
@@ -121,19 +137,463 @@ func TestForgotPassword(t *testing.T) {
 	}
 }
 
+func TestForgotPasswordEnumerationSafe(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{
+		WorkDir:        path.Join(wd, "../.."),
+		DefaultLocale:  "en",
+		Email:          testEmail,
+		ForgotPassword: config.ForgotPassword{EnumerationSafe: true, MinDuration: 50 * time.Millisecond},
+	})
+	defer includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	events := make([]audit.Event, 0)
+	includes.UseRecorder(recorderFunc(func(e audit.Event) {
+		events = append(events, e)
+	}))
+	defer includes.UseRecorder(nil)
+	store := suppression.NewMemory()
+	_ = store.Add(context.Background(), suppression.Suppression{Address: "bounced@example.com", Reason: suppression.ReasonBounce})
+	includes.UseSuppressions(store)
+	defer includes.UseSuppressions(nil)
+
+	sent := `{"message":"forgot password email sent successfully","data":null,"errors":null}`
+	token := `{"message":"password reset token successful","data":{"password_reset_token":"93142963-531d-4ca2-8b78-b5dc61f48c04"},"errors":{}}`
+	type E struct {
+		status int
+		data   string
+		events int
+	}
+	tests := []struct {
+		name          string
+		payload       io.Reader
+		secExchange   *microtest.Exchange
+		emailExchange *microtest.Exchange
+		E             E
+	}{
+		{
+			name:    "user not found",
+			payload: strings.NewReader(`{"email":"Name@Example.com"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 400,
+					Body:   `{"message":"BadRequest","data":{},"errors":{"user":["not found"]}}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   sent,
+				events: 1,
+			},
+		},
+		{
+			name:    "security service error",
+			payload: strings.NewReader(`{"email":"name@example.com"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 500,
+					Body:   `{"message":"InternalServerError","data":{},"errors":{"internal_server_error":["unable to connect"]}}`,
+				},
+			},
+			E: E{
+				status: 500,
+				data:   `{"message":"Internal Server Error","data":null,"errors":{"internal_server_error":["unable to connect"]}}`,
+			},
+		},
+		{
+			name:    "suppressed address",
+			payload: strings.NewReader(`{"email":"bounced@example.com"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   token,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   sent,
+			},
+		},
+		{
+			name:    "email service error",
+			payload: strings.NewReader(`{"email":"name@example.com"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   token,
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 500,
+					Body:   `{"message":"Internal Server Error","data":null,"errors":{"email":["unavailable"]}}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   sent,
+			},
+		},
+		{
+			name:    "successful",
+			payload: strings.NewReader(`{"email":"name@example.com"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   token,
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"email send successful","data":null,"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   sent,
+			},
+		},
+	}
+
+	securityMS := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer securityMS.Server.Close()
+	emailMS := microtest.NewMockServer("EMAIL_SERVICE_SCHEME", "EMAIL_SERVICE_HOST")
+	defer emailMS.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			events = events[:0]
+			securityMS.Append(tc.secExchange)
+			emailMS.Append(tc.emailExchange)
+
+			req := microtest.NewRequest("post", "/forgot-password", nil, nil, tc.payload)
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			ForgotPassword(rec, req)
+			elapsed := time.Since(start)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+			if len(events) != tc.E.events {
+				t.Errorf("expected %d events got %v", tc.E.events, events)
+			}
+			if tc.E.events > 0 && (events[0].Type != audit.PasswordResetUnknownAccount || events[0].Email != "name@example.com") {
+				t.Errorf("expected an unknown account event of %s got %v", "name@example.com", events[0])
+			}
+			if tc.E.status == 200 && elapsed < 50*time.Millisecond {
+				t.Errorf("expected the response to take at least %s got %s", 50*time.Millisecond, elapsed)
+			}
+		})
+	}
+}
+
+// recorderFunc records the events with the function.
+type recorderFunc func(e audit.Event)
+
+func (f recorderFunc) Record(_ context.Context, e audit.Event) error {
+	f(e)
+	return nil
+}
+
+func TestRevokePassword(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	events := make([]audit.Event, 0)
+	includes.UseRecorder(recorderFunc(func(e audit.Event) {
+		events = append(events, e)
+	}))
+	defer includes.UseRecorder(nil)
+
+	type E struct {
+		status int
+		data   string
+		events int
+	}
+	tests := []struct {
+		name          string
+		payload       io.Reader
+		secExchange   *microtest.Exchange
+		emailExchange *microtest.Exchange
+		E             E
+	}{
+		{
+			name:    "invalid payload",
+			payload: strings.NewReader(`{"password_reset_token":"abc"}`),
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"password_reset_token":["invalid token"]}}`,
+			},
+		},
+		{
+			name:    "token not found",
+			payload: strings.NewReader(`{"password_reset_token":"93142963-531d-4ca2-8b78-b5dc61f48c04"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 404,
+					Body:   `{"message":"NotFound","errors":{"password_reset_token":["not found"]}}`,
+				},
+			},
+			E: E{
+				status: 404,
+				data:   `{"message":"Not Found","data":null,"errors":{"password_reset_token":["not found"]}}`,
+			},
+		},
+		{
+			name:    "notification failed",
+			payload: strings.NewReader(`{"email":"attacker@example.com","password_reset_token":"93142963-531d-4ca2-8b78-b5dc61f48c04"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password reset token revoked","data":{"user":{"email":"Name@Example.com"}},"errors":{}}`,
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 500,
+					Body:   `{"message":"Internal Server Error","data":null,"errors":{"email":["unavailable"]}}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"password reset revoked","data":null,"errors":null}`,
+				events: 1,
+			},
+		},
+		{
+			name:    "successful",
+			payload: strings.NewReader(`{"password_reset_token":"93142963-531d-4ca2-8b78-b5dc61f48c04","locale":"af"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password reset token revoked","data":{"user":{"email":"name@example.com"}},"errors":{}}`,
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"email send successful","data":null,"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"password reset revoked","data":null,"errors":null}`,
+				events: 2,
+			},
+		},
+	}
+
+	securityMS := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer securityMS.Server.Close()
+	emailMS := microtest.NewMockServer("EMAIL_SERVICE_SCHEME", "EMAIL_SERVICE_HOST")
+	defer emailMS.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			securityMS.Append(tc.secExchange)
+			emailMS.Append(tc.emailExchange)
+
+			req := microtest.NewRequest("post", "/revoke-password", nil, nil, tc.payload)
+			rec := httptest.NewRecorder()
+			RevokePassword(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+			if len(events) != tc.E.events {
+				t.Errorf("expected %d recorded events got %d", tc.E.events, len(events))
+			}
+		})
+	}
+
+	if events[0].Type != audit.PasswordResetRevoked || events[0].Email != "name@example.com" {
+		t.Errorf("expected the revocation of the owner %s to be recorded got %v", "name@example.com", events[0])
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	events := make([]audit.Event, 0)
+	includes.UseRecorder(recorderFunc(func(e audit.Event) {
+		events = append(events, e)
+	}))
+	defer includes.UseRecorder(nil)
+
+	session := includes.Session{
+		Token: "test-token",
+		User:  security.User{FirstName: "James", LastName: "Bond", Email: "James@Bond.com"},
+	}
+	changed := `{"message":"password changed successfully","data":null,"errors":null}`
+	type E struct {
+		status int
+		data   string
+		events int
+	}
+	tests := []struct {
+		name          string
+		session       bool
+		payload       io.Reader
+		secExchange   *microtest.Exchange
+		emailExchange *microtest.Exchange
+		E             E
+	}{
+		{
+			name:    "no session",
+			payload: strings.NewReader(`{"current_password":"old","new_password":"new"}`),
+			E: E{
+				status: 401,
+				data:   `{"message":"Unauthorized","data":null,"errors":{"authentication":["token required","please login"]}}`,
+			},
+		},
+		{
+			name:    "invalid payload",
+			session: true,
+			payload: strings.NewReader(`{"current_password":"old","new_password":"old"}`),
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"new_password":["must differ from the current password"]}}`,
+			},
+		},
+		{
+			name:    "incorrect current password",
+			session: true,
+			payload: strings.NewReader(`{"current_password":"wrong","new_password":"new"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 400,
+					Body:   `{"message":"BadRequest","data":null,"errors":{"current_password":["incorrect"]}}`,
+				},
+			},
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"current_password":["incorrect"]}}`,
+			},
+		},
+		{
+			name:    "notification failed",
+			session: true,
+			payload: strings.NewReader(`{"current_password":"old","new_password":"new"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password changed","data":null,"errors":null}`,
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 500,
+					Body:   `{"message":"Internal Server Error","data":null,"errors":{"email":["unavailable"]}}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   changed,
+				events: 1,
+			},
+		},
+		{
+			name:    "successful",
+			session: true,
+			payload: strings.NewReader(`{"current_password":"old","new_password":"new","locale":"de"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password changed","data":null,"errors":null}`,
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"email send successful","data":null,"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   changed,
+				events: 1,
+			},
+		},
+	}
+
+	securityMS := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer securityMS.Server.Close()
+	emailMS := microtest.NewMockServer("EMAIL_SERVICE_SCHEME", "EMAIL_SERVICE_HOST")
+	defer emailMS.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			events = events[:0]
+			securityMS.Append(tc.secExchange)
+			emailMS.Append(tc.emailExchange)
+
+			req := microtest.NewRequest("post", "/change-password", nil, nil, tc.payload)
+			if tc.session {
+				req = WithSession(req, session)
+			}
+			rec := httptest.NewRecorder()
+			ChangePassword(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+			if len(events) != tc.E.events {
+				t.Errorf("expected %d recorded events got %d", tc.E.events, len(events))
+			}
+			if tc.E.events > 0 && (events[0].Type != audit.PasswordChanged || events[0].Email != "james@bond.com") {
+				t.Errorf("expected the change of %s to be recorded got %v", "james@bond.com", events[0])
+			}
+			if tc.secExchange != nil && tc.secExchange.Request.Header.Get("X-User-Token") != session.Token {
+				t.Errorf("expected the token of the session to be sent to the security service")
+			}
+		})
+	}
+}
+
 func TestContactUs(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
+	includes.Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		ContactUs: config.ContactUs{
+			NameMaxLength:    100,
+			MessageMaxLength: 5000,
+			MaxLinks:         2,
+			MinSubmitTime:    3 * time.Second,
+			Acknowledge:      true,
+			Categories:       []string{"account", "logbook", "billing"},
+		},
+	})
 
 	type E struct {
 		status int
 		data   string
 	}
 	tests := []struct {
-		name     string
-		payload  io.Reader
-		exchange *microtest.Exchange
-		E        E
+		name            string
+		payload         io.Reader
+		exchange        *microtest.Exchange
+		acknowledgement *microtest.Exchange
+		E               E
 	}{
 		{
 			name:     "bad request",
@@ -141,18 +601,62 @@ func TestContactUs(t *testing.T) {
 			exchange: nil,
 			E: E{
 				status: 400,
-				data:   `{"message":"Bad Request","data":null,"errors":{"replyTo":["address required"]}}`,
+				data:   `{"message":"Bad Request","data":null,"errors":{"email":["required"],"message":["required"],"name":["required"],"submit_time_ms":["required"]}}`,
+			},
+		},
+		{
+			name:     "invalid",
+			payload:  strings.NewReader(`{"name":"James Bond","email":"James Bond <name@example.com>, m@example.com","message":"see https://a.com www.b.com http://c.com","category":"sales","submit_time_ms":1200}`),
+			exchange: nil,
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"category":["must be one of account, logbook, billing"],"email":["invalid address"],"message":["maximum 2 links"],"submit_time_ms":["submitted too quickly"]}}`,
+			},
+		},
+		{
+			name:     "honeypot",
+			payload:  strings.NewReader(`{"name":"James Bond","email":"name@example.com","message":"buy now","website":"https://spam.com","submit_time_ms":200}`),
+			exchange: nil,
+			E: E{
+				status: 200,
+				data:   `{"message":"contact-us email sent successfully","data":null,"errors":null}`,
 			},
 		},
 		{
 			name:    "successful",
-			payload: strings.NewReader(`{"name":"James Bond", "email":"name@example.com","message":"here is\nmy message"}`),
+			payload: strings.NewReader(`{"name":"James Bond", "email":"name@example.com","message":"here is\nmy message","category":"Logbook","reference":"FL-1234","submit_time_ms":45000}`),
 			exchange: &microtest.Exchange{
 				Response: microtest.Response{
 					Status: 200,
 					Body:   `{"message":"message sent successfully","data":{},"errors":{}}`,
 				},
 			},
+			acknowledgement: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"message sent successfully","data":{},"errors":{}}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"contact-us email sent successfully","data":null,"errors":null}`,
+			},
+		},
+		{
+			name:    "acknowledgement failed",
+			payload: strings.NewReader(`{"name":"James Bond", "email":"name@example.com","message":"here is\nmy message","submit_time_ms":45000}`),
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"message sent successfully","data":{},"errors":{}}`,
+				},
+			},
+			acknowledgement: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 500,
+					Body:   `{"message":"Internal Server Error","data":null,"errors":{"internal_server_error":["unable to send"]}}`,
+				},
+			},
 			E: E{
 				status: 200,
 				data:   `{"message":"contact-us email sent successfully","data":null,"errors":null}`,
@@ -167,6 +671,7 @@ func TestContactUs(t *testing.T) {
 		name := fmt.Sprintf("%d %s", i, tc.name)
 		t.Run(name, func(t *testing.T) {
 			ms.Append(tc.exchange)
+			ms.Append(tc.acknowledgement)
 
 			req := microtest.NewRequest("post", "/contact-us", nil, nil, tc.payload)
 			rec := httptest.NewRecorder()
@@ -183,3 +688,35 @@ func TestContactUs(t *testing.T) {
 		})
 	}
 }
+
+func TestLocale(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	tests := []struct {
+		name           string
+		explicit       string
+		acceptLanguage string
+		locale         string
+	}{
+		{name: "default", explicit: "", acceptLanguage: "", locale: "en"},
+		{name: "accept-language", explicit: "", acceptLanguage: "de-DE,de;q=0.9,en;q=0.8", locale: "de"},
+		{name: "explicit overrides accept-language", explicit: "af", acceptLanguage: "de", locale: "af"},
+		{name: "unknown explicit falls back to accept-language", explicit: "fr", acceptLanguage: "de", locale: "de"},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			headers := map[string][]string{}
+			if tc.acceptLanguage != "" {
+				headers["Accept-Language"] = []string{tc.acceptLanguage}
+			}
+			req := microtest.NewRequest("POST", "/forgot-password", nil, headers, nil)
+			l := locale(req, tc.explicit)
+			if l != tc.locale {
+				t.Errorf("expected locale '%s' got '%s'", tc.locale, l)
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package handler
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
 	"github.com/dottics/securityserv"
+	"github.com/google/uuid"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
 // Error handles all error responses
@@ -19,7 +23,8 @@ func Error(w http.ResponseWriter, r *http.Request, err dutil.Error) {
 	res.Respond(w, r)
 }
 
-// Home is the health check for the server
+// Home is the health check for the server, it welcomes the brand of the
+// request host.
 func Home(w http.ResponseWriter, r *http.Request) {
 	msg := struct {
 		Alive bool `json:"alive"`
@@ -28,12 +33,27 @@ func Home(w http.ResponseWriter, r *http.Request) {
 	}
 	res := dutil.Resp{
 		Status:  200,
-		Message: "Welcome to the Budget API Gateway",
+		Message: fmt.Sprintf("Welcome to the %s API Gateway", brand(r).Name),
 		Data:    msg,
 	}
 	res.Respond(w, r)
 }
 
+// Live is the liveness check for the server, it does not check any of
+// the dependencies of the server.
+func Live(w http.ResponseWriter, r *http.Request) {
+	res := dutil.Resp{
+		Status:  200,
+		Message: "alive",
+		Data: struct {
+			Alive bool `json:"alive"`
+		}{
+			Alive: true,
+		},
+	}
+	res.Respond(w, r)
+}
+
 // Login handles the login of the budget api and  maps to the security service
 func Login(w http.ResponseWriter, r *http.Request) {
 	s := security.NewService("")
@@ -106,3 +126,49 @@ func ResetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 	resp.Respond(w, r)
 }
+
+// ResetPasswordToken reports the status and remaining lifetime of a
+// password reset token without consuming the token, so that the reset
+// password form is only shown for a valid token. The token is the r query
+// parameter of the reset password link or the password_reset_token of the
+// request body.
+func ResetPasswordToken(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("r")
+	if r.Method == http.MethodPost {
+		p := struct {
+			PasswordResetToken string `json:"password_reset_token"`
+		}{}
+		e := dutil.Decode(w, r, &p)
+		if e != nil {
+			Error(w, r, e)
+			return
+		}
+		token = p.PasswordResetToken
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		e := dutil.NewErr(400, "password_reset_token", []string{"required"})
+		Error(w, r, e)
+		return
+	}
+	t, err := uuid.Parse(token)
+	if err != nil {
+		e := dutil.NewErr(400, "password_reset_token", []string{"invalid token"})
+		Error(w, r, e)
+		return
+	}
+
+	status, e := includes.PasswordResetTokenStatus(t)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "password reset token " + status.Status,
+		Data:    status,
+	}
+	resp.Respond(w, r)
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
 	"github.com/johannesscr/micro/microtest"
 	"io"
 	"net/http/httptest"
+	"os"
+	"path"
 	"strings"
 	"testing"
 )
@@ -106,17 +110,63 @@ func TestError(t *testing.T) {
 }
 
 func TestHome(t *testing.T) {
-	req := httptest.NewRequest("GET", "/", nil)
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		Brands: map[string]config.Brand{
+			"flight-log": {Name: "Flight Log"},
+			"budget":     {Name: "Budget", Hosts: []string{"budget.dottics.com"}},
+		},
+		DefaultBrand: "flight-log",
+	})
+
+	tests := []struct {
+		host string
+		data string
+	}{
+		{
+			host: "example.com",
+			data: `{"message":"Welcome to the Flight Log API Gateway","data":{"alive":true},"errors":null}`,
+		},
+		{
+			host: "budget.dottics.com",
+			data: `{"message":"Welcome to the Budget API Gateway","data":{"alive":true},"errors":null}`,
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.host)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Host = tc.host
+			rec := httptest.NewRecorder()
+			Home(rec, req)
+
+			res, xb := microtest.ReadRecorder(rec)
+			if res.StatusCode != 200 {
+				t.Errorf("expecrted %d got %d", 200, res.StatusCode)
+			}
+			if string(bytes.TrimSpace(xb)) != tc.data {
+				t.Errorf("expected '%v' got  '%v'", tc.data, string(bytes.TrimSpace(xb)))
+			}
+		})
+	}
+}
+
+func TestLive(t *testing.T) {
+	req := httptest.NewRequest("GET", "/health/live", nil)
 	rec := httptest.NewRecorder()
-	Home(rec, req)
+	Live(rec, req)
 
 	res, xb := microtest.ReadRecorder(rec)
 	if res.StatusCode != 200 {
-		t.Errorf("expecrted %d got %d", 200, res.StatusCode)
+		t.Errorf("expected %d got %d", 200, res.StatusCode)
 	}
-	d := `{"message":"Welcome to the Budget API Gateway","data":{"alive":true},"errors":null}`
+	d := `{"message":"alive","data":{"alive":true},"errors":null}`
 	if string(bytes.TrimSpace(xb)) != d {
-		t.Errorf("expected '%v' got  '%v'", d, string(bytes.TrimSpace(xb)))
+		t.Errorf("expected '%v' got '%v'", d, string(bytes.TrimSpace(xb)))
 	}
 }
 
@@ -360,3 +410,107 @@ func TestResetPassword(t *testing.T) {
 		})
 	}
 }
+
+func TestResetPasswordToken(t *testing.T) {
+	type E struct {
+		status int
+		data   string
+	}
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		payload  io.Reader
+		exchange *microtest.Exchange
+		E        E
+	}{
+		{
+			name:   "required",
+			method: "GET",
+			target: "/reset-password/token",
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"password_reset_token":["required"]}}`,
+			},
+		},
+		{
+			name:    "invalid token",
+			method:  "POST",
+			target:  "/reset-password/token",
+			payload: strings.NewReader(`{"password_reset_token":"abc"}`),
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"password_reset_token":["invalid token"]}}`,
+			},
+		},
+		{
+			name:   "not found",
+			method: "GET",
+			target: "/reset-password/token?r=63a33ec6-1b11-4635-9def-391fc17bc6a0",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 404,
+					Body:   `{"message":"NotFound","data":null,"errors":{"password_reset_token":["not found"]}}`,
+				},
+			},
+			E: E{
+				status: 404,
+				data:   `{"message":"Not Found","data":null,"errors":{"password_reset_token":["not found"]}}`,
+			},
+		},
+		{
+			name:   "used",
+			method: "GET",
+			target: "/reset-password/token?r=63a33ec6-1b11-4635-9def-391fc17bc6a0",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password reset token status","data":{"status":"used","expires_at":"2023-01-01T00:00:00Z"},"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"password reset token used","data":{"status":"used","expires_at":"2023-01-01T00:00:00Z","expires_in":0},"errors":null}`,
+			},
+		},
+		{
+			name:    "revoked",
+			method:  "POST",
+			target:  "/reset-password/token",
+			payload: strings.NewReader(`{"password_reset_token":"63a33ec6-1b11-4635-9def-391fc17bc6a0"}`),
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password reset token status","data":{"status":"revoked","expires_at":"2023-01-01T00:00:00Z"},"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"password reset token revoked","data":{"status":"revoked","expires_at":"2023-01-01T00:00:00Z","expires_in":0},"errors":null}`,
+			},
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			req := httptest.NewRequest(tc.method, tc.target, tc.payload)
+			rec := httptest.NewRecorder()
+			ResetPasswordToken(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			d := string(bytes.TrimSpace(xb))
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status %d got %d", tc.E.status, res.StatusCode)
+			}
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+		})
+	}
+}
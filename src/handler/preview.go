@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+// EmailPreviews lists the email templates which can be previewed and the
+// locales of the templates.
+func EmailPreviews(w http.ResponseWriter, r *http.Request) {
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "email templates",
+		Data: map[string]interface{}{
+			"templates": includes.Templates(),
+			"locales":   includes.Locales(),
+		},
+	}
+	resp.Respond(w, r)
+}
+
+// EmailPreview renders the email template of the route with its sample
+// data without sending the email. The data is replaced by the fields of
+// the JSON body, or of the query parameters for a GET request. The locale
+// is the locale query parameter or the Accept-Language and the brand is
+// the brand query parameter or the brand of the request host. The HTML
+// and plain-text parts are returned as JSON, or only the one part when the
+// format query parameter is html or text.
+func EmailPreview(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var data []byte
+	if r.Method == http.MethodPost {
+		xb, err := io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			e := dutil.NewErr(400, "data", []string{"unable to read data", err.Error()})
+			Error(w, r, e)
+			return
+		}
+		data = xb
+	} else {
+		fields := make(map[string]string)
+		for k := range q {
+			if k != "locale" && k != "format" && k != "brand" {
+				fields[k] = q.Get(k)
+			}
+		}
+		if len(fields) > 0 {
+			data, _ = json.Marshal(fields)
+		}
+	}
+
+	b := brand(r)
+	if name := q.Get("brand"); name != "" {
+		var ok bool
+		b, ok = includes.LookupBrand(name)
+		if !ok {
+			e := dutil.NewErr(404, "brand", []string{"brand " + name + " not configured"})
+			Error(w, r, e)
+			return
+		}
+	}
+
+	p, e := includes.NewPreview(mux.Vars(r)["template"], locale(r, q.Get("locale")), b, data)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	switch q.Get("format") {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(200)
+		_, _ = io.WriteString(w, p.HTML)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		w.WriteHeader(200)
+		_, _ = io.WriteString(w, p.Text)
+	default:
+		resp := dutil.Resp{
+			Status:  200,
+			Message: "email preview",
+			Data:    p,
+		}
+		resp.Respond(w, r)
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/gorilla/mux"
+	"github.com/johannesscr/micro/microtest"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEmailPreview(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	type E struct {
+		status      int
+		contentType string
+		contains    string
+	}
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		template string
+		payload  io.Reader
+		E        E
+	}{
+		{
+			name:     "template not registered",
+			method:   "GET",
+			target:   "/dev/email-preview/welcome",
+			template: "welcome",
+			E: E{
+				status:      404,
+				contentType: "application/json",
+				contains:    `"template":["template welcome not registered"]`,
+			},
+		},
+		{
+			name:     "query data",
+			method:   "GET",
+			target:   "/dev/email-preview/contact-us?Name=Miss+Moneypenny&locale=af",
+			template: "contact-us",
+			E: E{
+				status:      200,
+				contentType: "application/json",
+				contains:    `"locale":"af"`,
+			},
+		},
+		{
+			name:     "body data",
+			method:   "POST",
+			target:   "/dev/email-preview/contact-us?format=text",
+			template: "contact-us",
+			payload:  strings.NewReader(`{"Message":"Shaken, not stirred."}`),
+			E: E{
+				status:      200,
+				contentType: "text/plain",
+				contains:    "Shaken, not stirred.",
+			},
+		},
+		{
+			name:     "brand not configured",
+			method:   "GET",
+			target:   "/dev/email-preview/contact-us?brand=budget",
+			template: "contact-us",
+			E: E{
+				status:      404,
+				contentType: "application/json",
+				contains:    `"brand":["brand budget not configured"]`,
+			},
+		},
+		{
+			name:     "html",
+			method:   "GET",
+			target:   "/dev/email-preview/contact-us?format=html&Name=Miss+Moneypenny",
+			template: "contact-us",
+			E: E{
+				status:      200,
+				contentType: "text/html",
+				contains:    "Miss Moneypenny",
+			},
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, tc.payload)
+			req = mux.SetURLVars(req, map[string]string{"template": tc.template})
+			rec := httptest.NewRecorder()
+			EmailPreview(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, tc.E.contentType) {
+				t.Errorf("expected content type %q got %q", tc.E.contentType, ct)
+			}
+			if !strings.Contains(string(xb), tc.E.contains) {
+				t.Errorf("expected body to contain %q got %s", tc.E.contains, xb)
+			}
+		})
+	}
+}
+
+func TestEmailPreviews(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	req := httptest.NewRequest("GET", "/dev/email-preview", nil)
+	rec := httptest.NewRecorder()
+	EmailPreviews(rec, req)
+	res, xb := microtest.ReadRecorder(rec)
+
+	if res.StatusCode != 200 {
+		t.Errorf("expected status code %d got %d", 200, res.StatusCode)
+	}
+	resp := struct {
+		Data struct {
+			Templates []string `json:"templates"`
+			Locales   []string `json:"locales"`
+		} `json:"data"`
+	}{}
+	_ = json.Unmarshal(xb, &resp)
+	if fmt.Sprint(resp.Data.Templates) != "[contact-us contact-us-acknowledgement forgot-password password-changed password-reset-revoked verify-email]" {
+		t.Errorf("expected templates %v got %v", "[contact-us contact-us-acknowledgement forgot-password password-changed password-reset-revoked verify-email]", resp.Data.Templates)
+	}
+	if fmt.Sprint(resp.Data.Locales) != "[af de en]" {
+		t.Errorf("expected locales %v got %v", "[af de en]", resp.Data.Locales)
+	}
+}
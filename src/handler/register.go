@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Register handles the registration of a new user with the security
+// microservice and sends the user the verification email. A failed
+// verification email does not fail the registration, the user can
+// request another with ResendVerification.
+func Register(w http.ResponseWriter, r *http.Request) {
+	p := includes.RegisterPayload{}
+	e := dutil.Decode(w, r, &p)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	p.FirstName = strings.TrimSpace(p.FirstName)
+	p.LastName = strings.TrimSpace(p.LastName)
+	p.Email = strings.TrimSpace(p.Email)
+	errs := p.Validate()
+	if len(errs) > 0 {
+		e := &dutil.Err{
+			Status: 400,
+			Errors: errs,
+		}
+		Error(w, r, e)
+		return
+	}
+
+	user, e := includes.RegisterUser(p)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	e = sendVerifyEmail(r, p.Email, p.Locale)
+	if e != nil {
+		log.Printf("register: unable to send the verification email: %v", e)
+	}
+
+	resp := dutil.Resp{
+		Status:  201,
+		Message: "user registered successfully",
+		Data:    map[string]interface{}{"user": user},
+	}
+	resp.Respond(w, r)
+}
+
+// VerifyEmail handles the verification of an email with the token of the
+// link of the verification email. The signature and expiry of the link are
+// checked before the token is verified with the security microservice.
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	p := includes.VerifyEmailPayload{}
+	e := dutil.Decode(w, r, &p)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	t, err := uuid.Parse(strings.TrimSpace(p.EmailVerificationToken))
+	if strings.TrimSpace(p.EmailVerificationToken) == "" {
+		e := dutil.NewErr(400, "email_verification_token", []string{"required"})
+		Error(w, r, e)
+		return
+	} else if err != nil {
+		e := dutil.NewErr(400, "email_verification_token", []string{"invalid token"})
+		Error(w, r, e)
+		return
+	}
+	e = includes.CheckVerifyEmailLink(t, p.Expires, strings.TrimSpace(p.Signature))
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	e = includes.VerifyEmail(t)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "email verified successfully",
+	}
+	resp.Respond(w, r)
+}
+
+// ResendVerification handles the request for another verification email.
+// When the forgot password flow is enumeration safe a request for an email
+// without a user receives the same response as any other request, which
+// is delayed to take at least the minimum duration of the flow.
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	p := includes.ResendVerificationPayload{}
+	e := dutil.Decode(w, r, &p)
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	p.Email = strings.TrimSpace(p.Email)
+	_, err := mail.ParseAddress(p.Email)
+	if p.Email == "" {
+		e := dutil.NewErr(400, "email", []string{"required"})
+		Error(w, r, e)
+		return
+	} else if err != nil {
+		e := dutil.NewErr(400, "email", []string{"invalid address"})
+		Error(w, r, e)
+		return
+	}
+
+	e = sendVerifyEmail(r, p.Email, p.Locale)
+	if e != nil && includes.EnumerationSafe() && includes.UserNotFound(e) {
+		log.Printf("resend-verification: no user with the email %s", includes.MaskEmail(p.Email))
+		e = nil
+	}
+	if e != nil {
+		Error(w, r, e)
+		return
+	}
+
+	includes.PadForgotPassword(r.Context(), start)
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "verification email sent successfully",
+	}
+	resp.Respond(w, r)
+}
+
+// sendVerifyEmail generates the email verification token of the user with
+// the email and sends the user the verification email.
+func sendVerifyEmail(r *http.Request, email, l string) dutil.Error {
+	t, e := includes.EmailVerificationToken(email)
+	if e != nil {
+		return e
+	}
+	msg := includes.NewVerifyEmailMsg(mail.Address{Address: email}, t, locale(r, l), brand(r))
+	e = msg.ExecuteTemplate()
+	if e != nil {
+		return e
+	}
+	return msg.SendMail()
+}
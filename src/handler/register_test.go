@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/google/uuid"
+	"github.com/johannesscr/micro/microtest"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testVerifyEmail is the email verification configuration of the tests.
+var testVerifyEmail = config.VerifyEmail{Secret: "s3cret", LinkTTL: time.Hour}
+
+func TestRegister(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail, VerifyEmail: testVerifyEmail})
+
+	user := `{"uuid":"3d9579de-162f-450a-8a7a-0cde0305d530","first_name":"James","last_name":"Bond","email":"james@bond.com","contact_number":"","password_reset_token":"","active":false}`
+	registered := `{"message":"user registered successfully","data":{"user":` + user + `},"errors":null}`
+	type E struct {
+		status int
+		data   string
+	}
+	tests := []struct {
+		name          string
+		payload       io.Reader
+		secExchanges  []*microtest.Exchange
+		emailExchange *microtest.Exchange
+		E             E
+	}{
+		{
+			name:    "invalid payload",
+			payload: strings.NewReader(`{"first_name":" ","last_name":"Bond","email":"james.bond.com"}`),
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"email":["invalid address"],"first_name":["required"],"password":["required"]}}`,
+			},
+		},
+		{
+			name:    "email exists",
+			payload: strings.NewReader(`{"first_name":"James","last_name":"Bond","email":"james@bond.com","password":"007"}`),
+			secExchanges: []*microtest.Exchange{{
+				Response: microtest.Response{
+					Status: 400,
+					Body:   `{"message":"BadRequest","data":null,"errors":{"email":["already exists"]}}`,
+				},
+			}},
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"email":["already exists"]}}`,
+			},
+		},
+		{
+			name:    "verification email not sent",
+			payload: strings.NewReader(`{"first_name":"James","last_name":"Bond","email":"james@bond.com","password":"007"}`),
+			secExchanges: []*microtest.Exchange{
+				{
+					Response: microtest.Response{
+						Status: 201,
+						Body:   `{"message":"user created","data":{"user":` + user + `},"errors":null}`,
+					},
+				},
+				{
+					Response: microtest.Response{
+						Status: 500,
+						Body:   `{"message":"InternalServerError","data":null,"errors":{"internal_server_error":["unable to connect"]}}`,
+					},
+				},
+			},
+			E: E{
+				status: 201,
+				data:   registered,
+			},
+		},
+		{
+			name:    "successful",
+			payload: strings.NewReader(`{"first_name":"James","last_name":"Bond","email":"james@bond.com","password":"007"}`),
+			secExchanges: []*microtest.Exchange{
+				{
+					Response: microtest.Response{
+						Status: 201,
+						Body:   `{"message":"user created","data":{"user":` + user + `},"errors":null}`,
+					},
+				},
+				{
+					Response: microtest.Response{
+						Status: 200,
+						Body:   `{"message":"token","data":{"email_verification_token":"93142963-531d-4ca2-8b78-b5dc61f48c04"},"errors":null}`,
+					},
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"email send successful","data":null,"errors":null}`,
+				},
+			},
+			E: E{
+				status: 201,
+				data:   registered,
+			},
+		},
+	}
+
+	securityMS := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer securityMS.Server.Close()
+	emailMS := microtest.NewMockServer("EMAIL_SERVICE_SCHEME", "EMAIL_SERVICE_HOST")
+	defer emailMS.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			for _, x := range tc.secExchanges {
+				securityMS.Append(x)
+			}
+			emailMS.Append(tc.emailExchange)
+
+			req := microtest.NewRequest("post", "/register", nil, nil, tc.payload)
+			rec := httptest.NewRecorder()
+			Register(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+			if tc.emailExchange != nil && tc.emailExchange.Request == nil {
+				t.Errorf("expected the verification email to be sent")
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	wd, _ := os.Getwd()
+	includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail, VerifyEmail: testVerifyEmail})
+
+	token := uuid.MustParse("93142963-531d-4ca2-8b78-b5dc61f48c04")
+	expires := time.Now().Add(time.Hour).Unix()
+	payload := func(expires int64, signature string) io.Reader {
+		return strings.NewReader(`{"email_verification_token":"` + token.String() + `","expires":` + strconv.FormatInt(expires, 10) + `,"signature":"` + signature + `"}`)
+	}
+	type E struct {
+		status int
+		data   string
+	}
+	tests := []struct {
+		name        string
+		payload     io.Reader
+		secExchange *microtest.Exchange
+		E           E
+	}{
+		{
+			name:    "invalid token",
+			payload: strings.NewReader(`{"email_verification_token":"abc"}`),
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"email_verification_token":["invalid token"]}}`,
+			},
+		},
+		{
+			name:    "invalid signature",
+			payload: payload(expires+60, includes.SignVerifyEmailLink(token, expires)),
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"signature":["invalid signature"]}}`,
+			},
+		},
+		{
+			name:    "token not found",
+			payload: payload(expires, includes.SignVerifyEmailLink(token, expires)),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 404,
+					Body:   `{"message":"NotFound","data":null,"errors":{"email_verification_token":["not found"]}}`,
+				},
+			},
+			E: E{
+				status: 404,
+				data:   `{"message":"Not Found","data":null,"errors":{"email_verification_token":["not found"]}}`,
+			},
+		},
+		{
+			name:    "successful",
+			payload: payload(expires, includes.SignVerifyEmailLink(token, expires)),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"email verified","data":null,"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"email verified successfully","data":null,"errors":null}`,
+			},
+		},
+	}
+
+	securityMS := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer securityMS.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			securityMS.Append(tc.secExchange)
+
+			req := microtest.NewRequest("post", "/verify-email", nil, nil, tc.payload)
+			rec := httptest.NewRecorder()
+			VerifyEmail(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer includes.Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	notFound := &microtest.Exchange{
+		Response: microtest.Response{
+			Status: 400,
+			Body:   `{"message":"BadRequest","data":null,"errors":{"user":["not found"]}}`,
+		},
+	}
+	type E struct {
+		status int
+		data   string
+	}
+	tests := []struct {
+		name            string
+		enumerationSafe bool
+		payload         io.Reader
+		secExchange     *microtest.Exchange
+		emailExchange   *microtest.Exchange
+		E               E
+	}{
+		{
+			name:    "invalid address",
+			payload: strings.NewReader(`{"email":"james.bond.com"}`),
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"email":["invalid address"]}}`,
+			},
+		},
+		{
+			name:        "user not found",
+			payload:     strings.NewReader(`{"email":"james@bond.com"}`),
+			secExchange: notFound,
+			E: E{
+				status: 400,
+				data:   `{"message":"Bad Request","data":null,"errors":{"user":["not found"]}}`,
+			},
+		},
+		{
+			name:            "user not found enumeration safe",
+			enumerationSafe: true,
+			payload:         strings.NewReader(`{"email":"james@bond.com"}`),
+			secExchange:     notFound,
+			E: E{
+				status: 200,
+				data:   `{"message":"verification email sent successfully","data":null,"errors":null}`,
+			},
+		},
+		{
+			name:    "successful",
+			payload: strings.NewReader(`{"email":"james@bond.com","locale":"de"}`),
+			secExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"token","data":{"email_verification_token":"93142963-531d-4ca2-8b78-b5dc61f48c04"},"errors":null}`,
+				},
+			},
+			emailExchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"email send successful","data":null,"errors":null}`,
+				},
+			},
+			E: E{
+				status: 200,
+				data:   `{"message":"verification email sent successfully","data":null,"errors":null}`,
+			},
+		},
+	}
+
+	securityMS := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer securityMS.Server.Close()
+	emailMS := microtest.NewMockServer("EMAIL_SERVICE_SCHEME", "EMAIL_SERVICE_HOST")
+	defer emailMS.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			includes.Configure(&config.Config{
+				WorkDir:        path.Join(wd, "../.."),
+				DefaultLocale:  "en",
+				Email:          testEmail,
+				VerifyEmail:    testVerifyEmail,
+				ForgotPassword: config.ForgotPassword{EnumerationSafe: tc.enumerationSafe, MinDuration: 50 * time.Millisecond},
+			})
+			securityMS.Append(tc.secExchange)
+			emailMS.Append(tc.emailExchange)
+
+			req := microtest.NewRequest("post", "/verify-email/resend", nil, nil, tc.payload)
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			ResendVerification(rec, req)
+			elapsed := time.Since(start)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+			if tc.enumerationSafe && elapsed < 50*time.Millisecond {
+				t.Errorf("expected the response to take at least %s got %s", 50*time.Millisecond, elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/outbox"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Probe checks the health of a single dependency of the gateway. If a
+// Critical dependency is unhealthy the gateway is not ready.
+type Probe struct {
+	Name     string
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+// ProbeResult is the outcome of a single Probe. The error is logged and not
+// served, it may reveal the internals of the gateway.
+type ProbeResult struct {
+	Name      string  `json:"name"`
+	Healthy   bool    `json:"healthy"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"-"`
+}
+
+// newProbes creates the probes of the gateway's dependencies.
+func (s *Server) newProbes() []Probe {
+	xp := []Probe{
+		{
+			Name:     "security-service",
+			Critical: true,
+			Check:    serviceCheck(s.Config.SecurityService),
+		},
+		{
+			// emails are queued while the email service is unavailable
+			Name:     "email-service",
+			Critical: s.Outbox == nil,
+			Check:    serviceCheck(s.Config.EmailService),
+		},
+		{
+			Name:     "templates",
+			Critical: true,
+			Check:    templatesCheck(s.Config.WorkDir),
+		},
+	}
+	if s.Outbox != nil {
+		xp = append(xp, Probe{
+			Name:     "outbox",
+			Critical: false,
+			Check:    outboxCheck(s.Outbox),
+		})
+	}
+	if s.Redis {
+		xp = append(xp, Probe{
+			Name:     "redis",
+			Critical: false,
+			Check: func(ctx context.Context) error {
+				return s.RedisClient.Ping(ctx).Err()
+			},
+		})
+	}
+	return xp
+}
+
+// serviceCheck returns a check which makes a request to the home endpoint
+// of the microservice, the microservice is healthy if it responds with a
+// 200.
+func serviceCheck(service config.Service) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		u := service.URL("/")
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != 200 {
+			return fmt.Errorf("unexpected status %d", res.StatusCode)
+		}
+		return nil
+	}
+}
+
+// templatesCheck returns a check that the email templates are available
+// in the working directory wd.
+func templatesCheck(wd string) func(ctx context.Context) error {
+	return func(_ context.Context) error {
+		dir := path.Join(wd, "templates")
+		xs, err := filepath.Glob(path.Join(dir, "*", "*.html"))
+		if err != nil {
+			return err
+		}
+		if len(xs) == 0 {
+			return fmt.Errorf("no templates found in %s", dir)
+		}
+		return nil
+	}
+}
+
+// outboxCheck returns a check that the outbox has no dead letters.
+func outboxCheck(o *outbox.Outbox) func(ctx context.Context) error {
+	return func(_ context.Context) error {
+		xe, err := o.Store.Dead()
+		if err != nil {
+			return err
+		}
+		if len(xe) > 0 {
+			return fmt.Errorf("%d dead letters", len(xe))
+		}
+		return nil
+	}
+}
+
+// probe runs all the probes concurrently, each probe is limited by the
+// probe timeout.
+func (s *Server) probe(ctx context.Context) []ProbeResult {
+	xr := make([]ProbeResult, len(s.Probes))
+	wg := sync.WaitGroup{}
+	for i, p := range s.Probes {
+		wg.Add(1)
+		go func(i int, p Probe) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, s.Config.HealthProbeTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := p.Check(ctx)
+			xr[i] = ProbeResult{
+				Name:      p.Name,
+				Healthy:   err == nil,
+				Critical:  p.Critical,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				xr[i].Error = err.Error()
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	return xr
+}
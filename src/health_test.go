@@ -0,0 +1,151 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/johannesscr/micro/microtest"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_readiness(t *testing.T) {
+	type E struct {
+		status int
+		ready  bool
+		errors map[string][]string
+	}
+	tests := []struct {
+		name          string
+		secExchange   *microtest.Exchange
+		emailExchange *microtest.Exchange
+		E             E
+	}{
+		{
+			name:          "ready",
+			secExchange:   &microtest.Exchange{Response: microtest.Response{Status: 200, Body: `{}`}},
+			emailExchange: &microtest.Exchange{Response: microtest.Response{Status: 200, Body: `{}`}},
+			E: E{
+				status: 200,
+				ready:  true,
+				errors: nil,
+			},
+		},
+		{
+			name:          "security service unhealthy",
+			secExchange:   &microtest.Exchange{Response: microtest.Response{Status: 500, Body: `{}`}},
+			emailExchange: &microtest.Exchange{Response: microtest.Response{Status: 200, Body: `{}`}},
+			E: E{
+				status: 503,
+				ready:  false,
+				errors: map[string][]string{
+					"security-service": {"unhealthy"},
+				},
+			},
+		},
+	}
+
+	securityMS := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer securityMS.Server.Close()
+	emailMS := microtest.NewMockServer("EMAIL_SERVICE_SCHEME", "EMAIL_SERVICE_HOST")
+	defer emailMS.Server.Close()
+
+	wd, _ := os.Getwd()
+	s := &Server{
+		Config: &config.Config{
+			WorkDir:            path.Join(wd, ".."),
+			SecurityService:    config.Service{Scheme: securityMS.URL.Scheme, Host: securityMS.URL.Host},
+			EmailService:       config.Service{Scheme: emailMS.URL.Scheme, Host: emailMS.URL.Host},
+			HealthProbeTimeout: time.Second,
+		},
+	}
+	s.Probes = s.newProbes()
+	s.ready.Store(true)
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			securityMS.Append(tc.secExchange)
+			emailMS.Append(tc.emailExchange)
+
+			req := httptest.NewRequest("GET", "/health/ready", nil)
+			rec := httptest.NewRecorder()
+			s.readiness(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			resp := struct {
+				Data struct {
+					Ready        bool          `json:"ready"`
+					Dependencies []ProbeResult `json:"dependencies"`
+				} `json:"data"`
+				Errors map[string][]string `json:"errors"`
+			}{}
+			_ = json.Unmarshal(xb, &resp)
+			if resp.Data.Ready != tc.E.ready {
+				t.Errorf("expected ready %v got %v", tc.E.ready, resp.Data.Ready)
+			}
+			if len(resp.Data.Dependencies) != 3 {
+				t.Errorf("expected %d dependencies got %d", 3, len(resp.Data.Dependencies))
+			}
+			if fmt.Sprint(resp.Errors) != fmt.Sprint(tc.E.errors) {
+				t.Errorf("expected errors %v got %v", tc.E.errors, resp.Errors)
+			}
+			if strings.Contains(string(xb), "unexpected status") {
+				t.Errorf("expected the reason of an unhealthy dependency not to be served got %s", xb)
+			}
+			if n := strings.Count(string(xb), `"latency_ms":`); n != 3 {
+				t.Errorf("expected the latency of %d dependencies got %d", 3, n)
+			}
+		})
+	}
+}
+
+func TestServer_probe(t *testing.T) {
+	s := &Server{
+		Config: &config.Config{HealthProbeTimeout: 50 * time.Millisecond},
+		Probes: []Probe{
+			{
+				Name:     "healthy",
+				Critical: true,
+				Check:    func(ctx context.Context) error { return nil },
+			},
+			{
+				Name:     "failing",
+				Critical: false,
+				Check:    func(ctx context.Context) error { return errors.New("connection refused") },
+			},
+			{
+				Name:     "slow",
+				Critical: true,
+				Check: func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+		},
+	}
+
+	xr := s.probe(context.Background())
+	tests := []ProbeResult{
+		{Name: "healthy", Healthy: true, Critical: true},
+		{Name: "failing", Healthy: false, Critical: false, Error: "connection refused"},
+		{Name: "slow", Healthy: false, Critical: true, Error: "context deadline exceeded"},
+	}
+	for i, pr := range tests {
+		if xr[i].Name != pr.Name || xr[i].Healthy != pr.Healthy || xr[i].Critical != pr.Critical || xr[i].Error != pr.Error {
+			t.Errorf("expected probe result %v got %v", pr, xr[i])
+		}
+	}
+	if xr[2].LatencyMS < 50 {
+		t.Errorf("expected latency of at least %d ms got %f", 50, xr[2].LatencyMS)
+	}
+}
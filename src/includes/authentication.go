@@ -1,9 +1,15 @@
 package includes
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/dottics/dutil"
 	security "github.com/dottics/securityserv"
 	"github.com/google/uuid"
+	"io"
+	"net/url"
+	"time"
 )
 
 // PasswordResetToken handles the exchange with the security microservice
@@ -23,9 +29,154 @@ func PasswordResetToken(p security.PasswordResetTokenPayload) (uuid.UUID, dutil.
 	//return "", nil
 }
 
+// UserNotFound reports whether the error of the security microservice is
+// that no user has the email of the request.
+func UserNotFound(e dutil.Error) bool {
+	if e == nil {
+		return false
+	}
+	for _, m := range dutil.Inst(e).Errors["user"] {
+		if m == "not found" {
+			return true
+		}
+	}
+	return false
+}
+
+// EnumerationSafe reports whether the forgot password flow hides whether
+// a user exists.
+func EnumerationSafe() bool {
+	return conf.ForgotPassword.EnumerationSafe
+}
+
+// PadForgotPassword waits until the minimum duration of the forgot password
+// flow has passed since start, or until the context is done, so that the
+// duration of the response does not reveal whether the user exists. It
+// returns immediately when the flow is not enumeration safe.
+func PadForgotPassword(ctx context.Context, start time.Time) {
+	d := conf.ForgotPassword.MinDuration - time.Since(start)
+	if !conf.ForgotPassword.EnumerationSafe || d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
 // ResetPassword handles the exchange with the security microservice to
 // reset a user's password.
 func ResetPassword(p security.ResetPasswordPayload) dutil.Error {
 	s := security.NewService("")
 	return s.ResetPassword(p)
 }
+
+// ChangePassword handles the exchange with the security microservice to
+// change the password of the user with the token. The security
+// microservice verifies the current password of the user.
+func ChangePassword(token string, p ChangePasswordPayload) dutil.Error {
+	p.Locale = ""
+	return securityExchange(token, "POST", "/change-password", p, 200, nil)
+}
+
+// RevokePasswordResetToken handles the exchange with the security
+// microservice to revoke a user's password reset token so that it can no
+// longer be used to reset the password. The owner of the token, as known
+// to the security microservice, is returned so that the owner and not the
+// requester can be notified.
+func RevokePasswordResetToken(t uuid.UUID) (security.User, dutil.Error) {
+	data := struct {
+		User security.User `json:"user"`
+	}{}
+	q := url.Values{"password_reset_token": []string{t.String()}}
+	e := securityExchange("", "DELETE", "/revoke-password-reset-token?"+q.Encode(), nil, 200, &data)
+	if e != nil {
+		return security.User{}, e
+	}
+	return data.User, nil
+}
+
+// PasswordResetTokenStatus handles the exchange with the security
+// microservice to check the validity of a password reset token without
+// consuming the token. The remaining lifetime of a valid token is
+// calculated from its expiry, a valid token which has passed its expiry is
+// expired.
+func PasswordResetTokenStatus(t uuid.UUID) (ResetTokenStatus, dutil.Error) {
+	status := ResetTokenStatus{}
+	q := url.Values{"password_reset_token": []string{t.String()}}
+	e := securityExchange("", "GET", "/reset-password/token/status?"+q.Encode(), nil, 200, &status)
+	if e != nil {
+		return ResetTokenStatus{}, e
+	}
+
+	switch status.Status {
+	case TokenValid, TokenExpired, TokenUsed, TokenRevoked:
+	default:
+		e := dutil.NewErr(502, "password_reset_token", []string{fmt.Sprintf("unknown status '%s'", status.Status)})
+		return ResetTokenStatus{}, e
+	}
+	status.ExpiresIn = 0
+	if status.Status == TokenValid {
+		remaining := time.Until(status.ExpiresAt)
+		if remaining <= 0 {
+			status.Status = TokenExpired
+		} else {
+			status.ExpiresIn = int64(remaining.Seconds())
+		}
+	}
+	return status, nil
+}
+
+// Authenticate handles the exchange with the security microservice to
+// validate a user's token. If the token is valid the user and the user's
+// permission codes are returned.
+func Authenticate(token string) (security.User, security.PermissionCodes, dutil.Error) {
+	s := security.NewService(token)
+	s.URL.Path = "/token/validate"
+
+	type data struct {
+		User            security.User            `json:"user"`
+		PermissionCodes security.PermissionCodes `json:"permission"`
+	}
+	resp := struct {
+		Message string              `json:"message"`
+		Data    data                `json:"data"`
+		Errors  map[string][]string `json:"errors"`
+	}{}
+
+	res, e := s.NewRequest("GET", s.URL.String(), nil, nil)
+	if e != nil {
+		return security.User{}, nil, e
+	}
+	e = decode(res.Body, &resp)
+	if e != nil {
+		return security.User{}, nil, e
+	}
+
+	if res.StatusCode != 200 {
+		e := &dutil.Err{
+			Status: res.StatusCode,
+			Errors: resp.Errors,
+		}
+		return security.User{}, nil, e
+	}
+
+	return resp.Data.User, resp.Data.PermissionCodes, nil
+}
+
+// decode reads and closes the body of a microservice response and
+// unmarshals it into the value pointed to by v.
+func decode(body io.ReadCloser, v interface{}) dutil.Error {
+	xb, err := io.ReadAll(body)
+	_ = body.Close()
+	if err != nil {
+		return dutil.NewErr(500, "read", []string{err.Error()})
+	}
+	err = json.Unmarshal(xb, v)
+	if err != nil {
+		return dutil.NewErr(500, "unmarshal", []string{err.Error()})
+	}
+	return nil
+}
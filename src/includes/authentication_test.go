@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/johannesscr/micro/microtest"
 	"testing"
+	"time"
 )
 
 func TestPasswordResetToken(t *testing.T) {
@@ -149,3 +150,294 @@ func TestResetPassword(t *testing.T) {
 		})
 	}
 }
+
+func TestRevokePasswordResetToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange *microtest.Exchange
+		email    string
+		e        dutil.Error
+	}{
+		{
+			name: "token not found",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 404,
+					Body:   `{"message":"NotFound","data":null,"errors":{"password_reset_token":["not found"]}}`,
+				},
+			},
+			e: dutil.NewErr(404, "password_reset_token", []string{"not found"}),
+		},
+		{
+			name: "revoked",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password reset token revoked","data":{"user":{"uuid":"3d9579de-162f-450a-8a7a-0cde0305d530","email":"james@bond.com"}},"errors":null}`,
+				},
+			},
+			email: "james@bond.com",
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			user, e := RevokePasswordResetToken(uuid.MustParse("93142963-531d-4ca2-8b78-b5dc61f48c04"))
+			req := tc.exchange.Request
+			if req == nil || req.Method != "DELETE" || req.URL.Query().Get("password_reset_token") != "93142963-531d-4ca2-8b78-b5dc61f48c04" {
+				t.Errorf("expected a DELETE of the token got %v", req)
+			}
+			if !dutil.ErrorEqual(e, tc.e) {
+				t.Errorf("expected error %v got %v", tc.e, e)
+			}
+			if user.Email != tc.email {
+				t.Errorf("expected owner '%s' got '%s'", tc.email, user.Email)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	type E struct {
+		user  security.User
+		codes security.PermissionCodes
+		e     dutil.Error
+	}
+	tests := []struct {
+		name     string
+		token    string
+		exchange *microtest.Exchange
+		E        E
+	}{
+		{
+			name:  "Unauthorized",
+			token: "expired-token",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 401,
+					Body:   `{"message":"Unauthorized","data":null,"errors":{"authentication":["token expired"]}}`,
+				},
+			},
+			E: E{
+				user:  security.User{},
+				codes: nil,
+				e: &dutil.Err{
+					Status: 401,
+					Errors: map[string][]string{
+						"authentication": {"token expired"},
+					},
+				},
+			},
+		},
+		{
+			name:  "Successful",
+			token: "valid-token",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"token valid","data":{"user":{"uuid":"ba0cb87d-6644-4b92-9e1d-0503c5563a3e","first_name":"james","last_name":"bond","email":"james@bond.com","active":true},"permission":["aio2","91j8"]},"errors":null}`,
+				},
+			},
+			E: E{
+				user: security.User{
+					UUID:      uuid.MustParse("ba0cb87d-6644-4b92-9e1d-0503c5563a3e"),
+					FirstName: "james",
+					LastName:  "bond",
+					Email:     "james@bond.com",
+					Active:    true,
+				},
+				codes: security.PermissionCodes{"aio2", "91j8"},
+				e:     nil,
+			},
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			u, xs, e := Authenticate(tc.token)
+			if u != tc.E.user {
+				t.Errorf("expected user %v got %v", tc.E.user, u)
+			}
+			if fmt.Sprint(xs) != fmt.Sprint(tc.E.codes) {
+				t.Errorf("expected permission codes %v got %v", tc.E.codes, xs)
+			}
+			if !dutil.ErrorEqual(e, tc.E.e) {
+				t.Errorf("expected error %v got %v", tc.E.e, e)
+			}
+			h := tc.exchange.Request.Header.Get("X-User-Token")
+			if h != tc.token {
+				t.Errorf("expected token '%s' got '%s'", tc.token, h)
+			}
+		})
+	}
+}
+
+func TestPasswordResetTokenStatus(t *testing.T) {
+	token := uuid.MustParse("3d9579de-162f-450a-8a7a-0cde0305d530")
+	future := time.Now().Add(30 * time.Minute).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		exchange *microtest.Exchange
+		status   string
+		e        dutil.Error
+	}{
+		{
+			name: "not found",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 404,
+					Body:   `{"message":"NotFound","data":null,"errors":{"password_reset_token":["not found"]}}`,
+				},
+			},
+			e: dutil.NewErr(404, "password_reset_token", []string{"not found"}),
+		},
+		{
+			name: "unknown status",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"status","data":{"status":"pending"},"errors":null}`,
+				},
+			},
+			e: dutil.NewErr(502, "password_reset_token", []string{"unknown status 'pending'"}),
+		},
+		{
+			name: "valid",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"status","data":{"status":"valid","expires_at":"` + future + `"},"errors":null}`,
+				},
+			},
+			status: TokenValid,
+		},
+		{
+			name: "valid past its expiry",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"status","data":{"status":"valid","expires_at":"2023-01-01T00:00:00Z"},"errors":null}`,
+				},
+			},
+			status: TokenExpired,
+		},
+		{
+			name: "used",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"status","data":{"status":"used","expires_at":"` + future + `"},"errors":null}`,
+				},
+			},
+			status: TokenUsed,
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			status, e := PasswordResetTokenStatus(token)
+			req := tc.exchange.Request
+			if req == nil || req.URL.Path != "/reset-password/token/status" || req.URL.Query().Get("password_reset_token") != token.String() {
+				t.Errorf("expected the status of token %s to be requested", token)
+			}
+			if !dutil.ErrorEqual(e, tc.e) {
+				t.Errorf("expected error %v got %v", tc.e, e)
+			}
+			if status.Status != tc.status {
+				t.Errorf("expected status '%s' got '%s'", tc.status, status.Status)
+			}
+			if tc.status == TokenValid && (status.ExpiresIn <= 25*60 || status.ExpiresIn > 30*60) {
+				t.Errorf("expected about %d seconds remaining got %d", 30*60, status.ExpiresIn)
+			}
+			if tc.status != TokenValid && status.ExpiresIn != 0 {
+				t.Errorf("expected no remaining lifetime got %d", status.ExpiresIn)
+			}
+		})
+	}
+}
+
+func TestUserNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		e    dutil.Error
+		E    bool
+	}{
+		{name: "no error", e: nil, E: false},
+		{name: "user not found", e: dutil.NewErr(400, "user", []string{"not found"}), E: true},
+		{name: "other error", e: dutil.NewErr(400, "email", []string{"not found"}), E: false},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			if UserNotFound(tc.e) != tc.E {
+				t.Errorf("expected %v got %v", tc.E, !tc.E)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange *microtest.Exchange
+		e        dutil.Error
+	}{
+		{
+			name: "incorrect current password",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 400,
+					Body:   `{"message":"BadRequest","data":null,"errors":{"current_password":["incorrect"]}}`,
+				},
+			},
+			e: dutil.NewErr(400, "current_password", []string{"incorrect"}),
+		},
+		{
+			name: "changed",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"password changed","data":null,"errors":null}`,
+				},
+			},
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			e := ChangePassword("test-token", ChangePasswordPayload{CurrentPassword: "old", NewPassword: "new"})
+			req := tc.exchange.Request
+			if req == nil || req.URL.Path != "/change-password" || req.Header.Get("X-User-Token") != "test-token" {
+				t.Errorf("expected a request to %s with the token got %v", "/change-password", req)
+			}
+			if !dutil.ErrorEqual(e, tc.e) {
+				t.Errorf("expected error %v got %v", tc.e, e)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package includes
+
+import (
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"net"
+	"strings"
+)
+
+// BrandData is the brand and the links of the data of every email
+// template, it is embedded in the data of the templates such that the
+// templates refer to {{.Brand.Name}} and {{.HomeLink}}.
+type BrandData struct {
+	Brand         config.Brand
+	HomeLink      string
+	ContactUsLink string
+}
+
+// NewBrandData returns the brand data of the brand b with the links to the
+// application of the brand.
+func NewBrandData(b config.Brand) BrandData {
+	u := b.App.URL("")
+	d := BrandData{Brand: b}
+	// Home
+	u.Path = "/"
+	d.HomeLink = u.String()
+	// Contact us
+	u.Path = "/contact-us"
+	d.ContactUsLink = u.String()
+	return d
+}
+
+// LookupBrand returns the configured brand by name.
+func LookupBrand(name string) (config.Brand, bool) {
+	b, ok := conf.Brands[name]
+	return b, ok
+}
+
+// ResolveBrand returns the brand of which the request host is one of the
+// hosts, with or without the port, and the default brand otherwise.
+func ResolveBrand(host string) config.Brand {
+	host = strings.ToLower(strings.TrimSpace(host))
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, b := range conf.Brands {
+		for _, h := range b.Hosts {
+			h = strings.ToLower(h)
+			if h == host || h == hostname {
+				return b
+			}
+		}
+	}
+	b, ok := conf.Brands[conf.DefaultBrand]
+	if !ok {
+		return config.Brand{App: conf.App}
+	}
+	return b
+}
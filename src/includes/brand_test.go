@@ -0,0 +1,94 @@
+package includes
+
+import (
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/google/uuid"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestResolveBrand(t *testing.T) {
+	defer func(c *config.Config) { conf = c }(conf)
+	conf = &config.Config{
+		Brands: map[string]config.Brand{
+			"flight-log": {Name: "Flight Log"},
+			"budget":     {Name: "Budget", Hosts: []string{"budget.dottics.com", "localhost:5031"}},
+		},
+		DefaultBrand: "flight-log",
+	}
+
+	tests := []struct {
+		host  string
+		brand string
+	}{
+		{host: "budget.dottics.com", brand: "Budget"},
+		{host: "Budget.Dottics.com:443", brand: "Budget"},
+		{host: "localhost:5031", brand: "Budget"},
+		{host: "localhost:5030", brand: "Flight Log"},
+		{host: "flight-log.dottics.com", brand: "Flight Log"},
+		{host: "", brand: "Flight Log"},
+	}
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.host)
+		t.Run(name, func(t *testing.T) {
+			b := ResolveBrand(tc.host)
+			if b.Name != tc.brand {
+				t.Errorf("expected brand '%s' got '%s'", tc.brand, b.Name)
+			}
+		})
+	}
+}
+
+func TestNewBrandData(t *testing.T) {
+	d := NewBrandData(testBrand)
+	if d.Brand.Name != testBrand.Name {
+		t.Errorf("expected brand '%s' got '%s'", testBrand.Name, d.Brand.Name)
+	}
+	if d.HomeLink != "https://test.dottics.com/" || d.ContactUsLink != "https://test.dottics.com/contact-us" {
+		t.Errorf("expected the links of the brand app got %s and %s", d.HomeLink, d.ContactUsLink)
+	}
+}
+
+func TestForgotPasswordMsg_Brand(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	b := config.Brand{
+		Name:        "Budget",
+		LogoURL:     "https://budget.dottics.com/logo.png",
+		Colors:      config.BrandColors{Primary: "#2bcbba", Secondary: "#35e8af"},
+		FooterLinks: []config.Link{{Text: "Privacy Policy", URL: "https://budget.dottics.com/privacy"}},
+		Support:     mail.Address{Address: "budget@dottics.com"},
+		App:         config.Service{Scheme: "https", Host: "budget.dottics.com"},
+	}
+	msg := NewForgotPasswordMsg(mail.Address{Address: "james@bond.com"}, uuid.New(), "en", b)
+	e := msg.ExecuteTemplate()
+	if e != nil {
+		t.Fatalf("expected error %v got %v", nil, e)
+	}
+
+	for _, s := range []string{
+		"<h4>Budget</h4>",
+		`<img src="https://budget.dottics.com/logo.png" alt="Budget">`,
+		"--color-brand-primary: #2bcbba;",
+		`<a href="https://budget.dottics.com/">Budget Home Page</a>`,
+		`<a href="https://budget.dottics.com/privacy">Privacy Policy</a>`,
+		`<a href="mailto:budget@dottics.com">budget@dottics.com</a>`,
+		"https://budget.dottics.com/reset-password?r=",
+	} {
+		if !strings.Contains(msg.HTML, s) {
+			t.Errorf("expected the html to contain %s", s)
+		}
+	}
+	if strings.Contains(msg.HTML, "dottics-logo") {
+		t.Errorf("expected the logo of the brand instead of the dottics logo")
+	}
+	for _, s := range []string{"Support: budget@dottics.com", "Privacy Policy: https://budget.dottics.com/privacy"} {
+		if !strings.Contains(msg.Text, s) {
+			t.Errorf("expected the text to contain %s", s)
+		}
+	}
+}
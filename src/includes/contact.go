@@ -0,0 +1,154 @@
+package includes
+
+import (
+	"context"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var linkRe = regexp.MustCompile(`(?i)\b(https?://|www\.)`)
+
+// referenceMaxLength limits the length of the reference of a message.
+const referenceMaxLength = 100
+
+// Sanitize trims the fields of the payload and strips the control and
+// formatting characters, except for the line breaks and tabs of the
+// message.
+func (p *ContactUsMsgPayload) Sanitize() {
+	p.Name = strings.TrimSpace(stripControl(p.Name, false))
+	p.Email = strings.TrimSpace(stripControl(p.Email, false))
+	p.Category = strings.ToLower(strings.TrimSpace(stripControl(p.Category, false)))
+	p.Reference = strings.TrimSpace(stripControl(p.Reference, false))
+	p.Message = strings.ReplaceAll(p.Message, "\r\n", "\n")
+	p.Message = strings.TrimSpace(stripControl(p.Message, true))
+}
+
+// stripControl removes the control and formatting characters of s, if
+// multiline the line breaks and tabs are kept.
+func stripControl(s string, multiline bool) string {
+	return strings.Map(func(r rune) rune {
+		if multiline && (r == '\n' || r == '\t') {
+			return r
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Sender returns the address of the sender of the message.
+func (p *ContactUsMsgPayload) Sender() mail.Address {
+	return mail.Address{
+		Name:    p.Name,
+		Address: p.Email,
+	}
+}
+
+// Honeypot reports whether the honeypot of the form is filled out, which
+// is only done by bots.
+func (p *ContactUsMsgPayload) Honeypot() bool {
+	return strings.TrimSpace(p.Website) != ""
+}
+
+// Validate validates the sanitized payload against the contact us
+// configuration and returns the errors by field. The email must be a
+// single RFC 5322 address, the name and message are limited in length and
+// the message may only have a few links and no blocked keywords. The
+// category must be one of the configured categories. A form which was
+// filled out faster than humanly possible is rejected.
+func (p *ContactUsMsgPayload) Validate() map[string][]string {
+	c := conf.ContactUs
+	errs := make(map[string][]string)
+
+	if p.Name == "" {
+		errs["name"] = append(errs["name"], "required")
+	} else if c.NameMaxLength > 0 && utf8.RuneCountInString(p.Name) > c.NameMaxLength {
+		errs["name"] = append(errs["name"], fmt.Sprintf("maximum %d characters", c.NameMaxLength))
+	}
+
+	if p.Email == "" {
+		errs["email"] = append(errs["email"], "required")
+	} else if a, err := mail.ParseAddress(p.Email); err != nil || a.Address != p.Email {
+		errs["email"] = append(errs["email"], "invalid address")
+	}
+
+	if p.Message == "" {
+		errs["message"] = append(errs["message"], "required")
+	} else if c.MessageMaxLength > 0 && utf8.RuneCountInString(p.Message) > c.MessageMaxLength {
+		errs["message"] = append(errs["message"], fmt.Sprintf("maximum %d characters", c.MessageMaxLength))
+	}
+	if n := len(linkRe.FindAllString(p.Message, -1)); n > c.MaxLinks {
+		errs["message"] = append(errs["message"], fmt.Sprintf("maximum %d links", c.MaxLinks))
+	}
+	text := strings.ToLower(p.Name + "\n" + p.Message)
+	for _, k := range c.BlockedKeywords {
+		if strings.Contains(text, k) {
+			errs["message"] = append(errs["message"], "contains blocked content")
+			break
+		}
+	}
+
+	if p.Category != "" && !contains(c.Categories, p.Category) {
+		if len(c.Categories) == 0 {
+			errs["category"] = append(errs["category"], "unknown category")
+		} else {
+			errs["category"] = append(errs["category"], fmt.Sprintf("must be one of %s", strings.Join(c.Categories, ", ")))
+		}
+	}
+	if utf8.RuneCountInString(p.Reference) > referenceMaxLength {
+		errs["reference"] = append(errs["reference"], fmt.Sprintf("maximum %d characters", referenceMaxLength))
+	}
+
+	if c.MinSubmitTime > 0 {
+		if p.SubmitTimeMS <= 0 {
+			errs["submit_time_ms"] = append(errs["submit_time_ms"], "required")
+		} else if time.Duration(p.SubmitTimeMS)*time.Millisecond < c.MinSubmitTime {
+			errs["submit_time_ms"] = append(errs["submit_time_ms"], "submitted too quickly")
+		}
+	}
+	return errs
+}
+
+func contains(xs []string, s string) bool {
+	for _, x := range xs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AcknowledgeContactUs sends the acknowledgement of a contact us message
+// to the sender to. It reports whether the acknowledgement was sent, it is
+// skipped if acknowledgements are disabled or the address exceeded the
+// "contact-us-acknowledgement:email" rate limit.
+func AcknowledgeContactUs(ctx context.Context, to mail.Address, locale string, b config.Brand) (bool, dutil.Error) {
+	if !conf.ContactUs.Acknowledge {
+		return false, nil
+	}
+	name := "contact-us-acknowledgement:email"
+	if l, ok := conf.RateLimit.Limits[name]; ok && limiter != nil {
+		allowed, _ := limiter.Allow(ctx, name+":"+strings.ToLower(to.Address), l)
+		if !allowed {
+			return false, nil
+		}
+	}
+	msg := NewContactUsAcknowledgementMsg(to, locale, b)
+	e := msg.ExecuteTemplate()
+	if e != nil {
+		return false, e
+	}
+	e = msg.SendMail()
+	if e != nil {
+		return false, e
+	}
+	return true, nil
+}
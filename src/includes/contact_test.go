@@ -0,0 +1,202 @@
+package includes
+
+import (
+	"context"
+	"fmt"
+	"github.com/dottics/emailserv"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContactUsMsgPayload_Sanitize(t *testing.T) {
+	p := ContactUsMsgPayload{
+		Name:      " James\r\nBcc: spam@example.com\u200b ",
+		Email:     " name@example.com\x00",
+		Message:   "\x1b[31mHi there,\r\n\r\n\tregards\u202e ",
+		Category:  " Billing\n",
+		Reference: "\tINV-42 ",
+	}
+	p.Sanitize()
+	if p.Name != "JamesBcc: spam@example.com" {
+		t.Errorf("expected name %q got %q", "JamesBcc: spam@example.com", p.Name)
+	}
+	if p.Email != "name@example.com" {
+		t.Errorf("expected email %q got %q", "name@example.com", p.Email)
+	}
+	if p.Message != "[31mHi there,\n\n\tregards" {
+		t.Errorf("expected message %q got %q", "[31mHi there,\n\n\tregards", p.Message)
+	}
+	if p.Category != "billing" || p.Reference != "INV-42" {
+		t.Errorf("expected category %q and reference %q got %q and %q", "billing", "INV-42", p.Category, p.Reference)
+	}
+}
+
+func TestContactUsMsgPayload_Validate(t *testing.T) {
+	defer func(c *config.Config) { conf = c }(conf)
+	conf = &config.Config{
+		ContactUs: config.ContactUs{
+			NameMaxLength:    10,
+			MessageMaxLength: 20,
+			MaxLinks:         1,
+			BlockedKeywords:  []string{"casino"},
+			MinSubmitTime:    3 * time.Second,
+			Categories:       []string{"account", "billing"},
+		},
+	}
+
+	valid := func() ContactUsMsgPayload {
+		return ContactUsMsgPayload{
+			Name:         "James",
+			Email:        "james@bond.com",
+			Message:      "Hi there",
+			SubmitTimeMS: 5000,
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(p *ContactUsMsgPayload)
+		errs   map[string][]string
+	}{
+		{
+			name:   "valid",
+			modify: func(p *ContactUsMsgPayload) {},
+			errs:   map[string][]string{},
+		},
+		{
+			name:   "name too long",
+			modify: func(p *ContactUsMsgPayload) { p.Name = "Jämes Bönd 007" },
+			errs:   map[string][]string{"name": {"maximum 10 characters"}},
+		},
+		{
+			name:   "invalid email",
+			modify: func(p *ContactUsMsgPayload) { p.Email = "james.bond.com" },
+			errs:   map[string][]string{"email": {"invalid address"}},
+		},
+		{
+			name:   "message too long with links",
+			modify: func(p *ContactUsMsgPayload) { p.Message = "visit www.a.com and https://b.com" },
+			errs:   map[string][]string{"message": {"maximum 20 characters", "maximum 1 links"}},
+		},
+		{
+			name:   "blocked keyword",
+			modify: func(p *ContactUsMsgPayload) { p.Message = "Best CASINO" },
+			errs:   map[string][]string{"message": {"contains blocked content"}},
+		},
+		{
+			name:   "known category",
+			modify: func(p *ContactUsMsgPayload) { p.Category = "billing"; p.Reference = "INV-42" },
+			errs:   map[string][]string{},
+		},
+		{
+			name:   "unknown category",
+			modify: func(p *ContactUsMsgPayload) { p.Category = "sales" },
+			errs:   map[string][]string{"category": {"must be one of account, billing"}},
+		},
+		{
+			name:   "reference too long",
+			modify: func(p *ContactUsMsgPayload) { p.Reference = strings.Repeat("x", 101) },
+			errs:   map[string][]string{"reference": {"maximum 100 characters"}},
+		},
+		{
+			name:   "submitted too quickly",
+			modify: func(p *ContactUsMsgPayload) { p.SubmitTimeMS = 800 },
+			errs:   map[string][]string{"submit_time_ms": {"submitted too quickly"}},
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			p := valid()
+			tc.modify(&p)
+			errs := p.Validate()
+			if fmt.Sprint(errs) != fmt.Sprint(tc.errs) {
+				t.Errorf("expected errors %v got %v", tc.errs, errs)
+			}
+		})
+	}
+
+	// the time to submit is not checked when it is disabled
+	conf.ContactUs.MinSubmitTime = 0
+	p := valid()
+	p.SubmitTimeMS = 0
+	if errs := p.Validate(); len(errs) > 0 {
+		t.Errorf("expected no errors got %v", errs)
+	}
+
+	// without categories a message may not have a category
+	conf.ContactUs.Categories = nil
+	p.Category = "billing"
+	if errs := p.Validate(); fmt.Sprint(errs) != "map[category:[unknown category]]" {
+		t.Errorf("expected an unknown category got %v", errs)
+	}
+}
+
+func TestContactUsMsgPayload_Honeypot(t *testing.T) {
+	p := ContactUsMsgPayload{Website: " "}
+	if p.Honeypot() {
+		t.Errorf("expected the honeypot not to be filled out")
+	}
+	p.Website = "https://spam.com"
+	if !p.Honeypot() {
+		t.Errorf("expected the honeypot to be filled out")
+	}
+}
+
+func TestAcknowledgeContactUs(t *testing.T) {
+	wd, _ := os.Getwd()
+	c := &config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+		ContactUs:     config.ContactUs{Acknowledge: true},
+		RateLimit: config.RateLimit{
+			Limits: map[string]ratelimit.Limit{
+				"contact-us-acknowledgement:email": {Requests: 1, Window: time.Hour},
+			},
+		},
+	}
+	Configure(c)
+	defer UseQueue(nil)
+	defer UseLimiter(nil)
+	queued := make([]*emailserv.Message, 0)
+	UseQueue(queueFunc(func(m *emailserv.Message) error {
+		queued = append(queued, m)
+		return nil
+	}))
+	UseLimiter(ratelimit.NewMemory())
+
+	tests := []struct {
+		name        string
+		to          string
+		acknowledge bool
+		sent        bool
+	}{
+		{name: "sent", to: "james@bond.com", acknowledge: true, sent: true},
+		{name: "address rate limited", to: "James@Bond.com", acknowledge: true, sent: false},
+		{name: "other address", to: "miss@moneypenny.com", acknowledge: true, sent: true},
+		{name: "disabled", to: "q@mi6.com", acknowledge: false, sent: false},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			c.ContactUs.Acknowledge = tc.acknowledge
+			n := len(queued)
+			sent, e := AcknowledgeContactUs(context.Background(), mail.Address{Address: tc.to}, "en", testBrand)
+			if e != nil {
+				t.Errorf("expected error %v got %v", nil, e)
+			}
+			if sent != tc.sent || (len(queued) > n) != tc.sent {
+				t.Errorf("expected sent %v got %v with %d queued", tc.sent, sent, len(queued)-n)
+			}
+		})
+	}
+}
@@ -2,45 +2,109 @@ package includes
 
 import (
 	"fmt"
-	"github.com/dottics/dutil"
-	"github.com/dottics/emailserv"
+	"github.com/dottics/flight-log-api-gateway/src/config"
 	"github.com/google/uuid"
-	"html/template"
 	"net/mail"
 	"net/url"
-	"os"
-	"path"
+	"strconv"
+	"time"
 )
 
-func loadTemplate() *template.Template {
-	wd := os.Getenv("WORKDIR")
-	templates := path.Join(wd, "templates/*.html")
-	tpl := template.Must(template.New("").ParseGlob(templates))
-	return tpl
+func init() {
+	Register(&Template{
+		Name:    "forgot-password",
+		Subject: "Dottics Forgot Password",
+		Subjects: map[string]string{
+			"af": "Dottics Wagwoord Vergeet",
+			"de": "Dottics Passwort vergessen",
+		},
+		Data: &ForgotPasswordData{},
+		Sample: func(b config.Brand) interface{} {
+			return NewForgotPasswordData(uuid.New(), b)
+		},
+	})
+	Register(&Template{
+		Name:    "password-reset-revoked",
+		Subject: "Dottics Password Reset Revoked",
+		Subjects: map[string]string{
+			"af": "Dottics Wagwoordherstel Herroep",
+			"de": "Dottics Zurücksetzen des Passworts widerrufen",
+		},
+		Data: &PasswordResetRevokedData{},
+		Sample: func(b config.Brand) interface{} {
+			return NewPasswordResetRevokedData(b)
+		},
+	})
+	Register(&Template{
+		Name:    "password-changed",
+		Subject: "Dottics Password Changed",
+		Subjects: map[string]string{
+			"af": "Dottics Wagwoord Verander",
+			"de": "Dottics Passwort geändert",
+		},
+		Data: &PasswordChangedData{},
+		Sample: func(b config.Brand) interface{} {
+			return NewPasswordChangedData(time.Now(), b)
+		},
+	})
+	Register(&Template{
+		Name:    "verify-email",
+		Subject: "Dottics Verify Your Email",
+		Subjects: map[string]string{
+			"af": "Dottics Bevestig jou E-pos",
+			"de": "Dottics Bestätigen Sie Ihre E-Mail",
+		},
+		Data: &VerifyEmailData{},
+		Sample: func(b config.Brand) interface{} {
+			return NewVerifyEmailData(uuid.New(), time.Now().Add(24*time.Hour), b)
+		},
+	})
+	Register(&Template{
+		Name:    "contact-us",
+		Subject: "Dottics Contact Us",
+		Subjects: map[string]string{
+			"af": "Dottics Kontak Ons",
+			"de": "Dottics Kontakt",
+		},
+		Inbox: true,
+		Data:  &ContactUsData{},
+		Sample: func(b config.Brand) interface{} {
+			d := NewContactUsData(b, "James Bond", "james@bond.com", "Hi there,\n\nThe hours of my last flight are missing from my logbook.")
+			d.Category = "logbook"
+			d.Reference = "FL-1234"
+			return d
+		},
+	})
+	Register(&Template{
+		Name:    "contact-us-acknowledgement",
+		Subject: "Dottics We Received Your Message",
+		Subjects: map[string]string{
+			"af": "Dottics Ons het jou Boodskap Ontvang",
+			"de": "Dottics Wir haben Ihre Nachricht erhalten",
+		},
+		Data: &ContactUsAcknowledgementData{},
+		Sample: func(b config.Brand) interface{} {
+			return NewContactUsAcknowledgementData(b)
+		},
+	})
 }
 
 type ForgotPasswordData struct {
+	BrandData
 	Token                   uuid.UUID
 	ResetPasswordLink       string
 	RevokeResetPasswordLink string
-	HomeLink                string
-	ContactUsLink           string
 }
 
 // NewForgotPasswordData gets all the basic forgot password email body
-// information from the environment and returns a new instance of the
-// forgot password email body to populate the email template.
-func NewForgotPasswordData(t uuid.UUID) *ForgotPasswordData {
-	scheme := os.Getenv("APP_SCHEME")
-	host := os.Getenv("APP_HOST")
-	u := url.URL{
-		Scheme: scheme,
-		Host:   host,
-	}
+// information from the brand b and returns a new instance of the forgot
+// password email body to populate the email template.
+func NewForgotPasswordData(t uuid.UUID, b config.Brand) *ForgotPasswordData {
+	u := b.App.URL("")
 	q := url.Values{
 		"r": []string{t.String()},
 	}
-	m := &ForgotPasswordData{}
+	m := &ForgotPasswordData{BrandData: NewBrandData(b)}
 	m.Token = t
 	// Reset password
 	u.Path = "/reset-password"
@@ -50,181 +114,190 @@ func NewForgotPasswordData(t uuid.UUID) *ForgotPasswordData {
 	u.Path = "/revoke-password"
 	u.RawQuery = q.Encode()
 	m.RevokeResetPasswordLink = u.String()
-	// Home
-	u.Path = "/"
-	u.RawQuery = ""
-	m.HomeLink = u.String()
-	// Contact us
-	u.Path = "/contact-us"
-	u.RawQuery = ""
-	m.ContactUsLink = u.String()
 	return m
 }
 
-type ForgotPasswordMsg struct {
-	Message *emailserv.Message
-	Data    *ForgotPasswordData
-}
+// ForgotPasswordMsg is the forgot password email.
+type ForgotPasswordMsg = Msg[*ForgotPasswordData]
 
 // NewForgotPasswordMsg does the basic scaffolding and data manipulation
-// for the forgot password email.
-func NewForgotPasswordMsg(to mail.Address, t uuid.UUID) *ForgotPasswordMsg {
-	msg := &ForgotPasswordMsg{
-		Message: &emailserv.Message{
-			Headers: map[string][]string{
-				"Mime-Version": {"1.0"},
-				"Content-Type": {"text/html", "charset=UTF-8"},
-			},
-			From: mail.Address{
-				Name:    "No-Reply Dottics",
-				Address: "mail@dottics.com",
-			},
-			To: []mail.Address{to},
-			ReplyTo: mail.Address{
-				Name:    "Johannes Scribante",
-				Address: "js@dottics.com",
-			},
-			Subject: "Dottics Forgot Password",
-		},
-		Data: NewForgotPasswordData(t),
-	}
+// for the forgot password email of the brand b in the locale.
+func NewForgotPasswordMsg(to mail.Address, t uuid.UUID, locale string, b config.Brand) *ForgotPasswordMsg {
+	msg := mustNewMsg("forgot-password", locale, NewForgotPasswordData(t, b))
+	msg.Message.To = append(msg.Message.To, to)
 	return msg
 }
 
-// ExecuteTemplate creates an HTML file for the forgot password email. It
-// executes the template to populate the template with data. Then it reads
-// the HTML file and converts it to a string for the emailserv.Message
-// body.
-func (msg *ForgotPasswordMsg) ExecuteTemplate() dutil.Error {
-	tpl := loadTemplate()
-	wd := os.Getenv("WORKDIR")
-	u, err := uuid.NewUUID()
-	if err != nil {
-		e := dutil.NewErr(500, "uuid", []string{"unable to generate uuid", err.Error()})
-		return e
-	}
+// PasswordResetRevokedData is the body of the notification to the owner of
+// an account that the password reset was revoked.
+type PasswordResetRevokedData struct {
+	BrandData
+}
 
-	name := path.Join(wd, "documents", fmt.Sprintf("forgot-password-%s.html", u.String()))
-	file, err := os.Create(name)
-	if err != nil {
-		e := dutil.NewErr(500, "document", []string{"unable to create document", err.Error()})
-		return e
-	}
+// NewPasswordResetRevokedData returns the password reset revoked email
+// body with the brand b.
+func NewPasswordResetRevokedData(b config.Brand) *PasswordResetRevokedData {
+	return &PasswordResetRevokedData{BrandData: NewBrandData(b)}
+}
 
-	err = tpl.ExecuteTemplate(file, "forgot-password.html", msg.Data)
-	if err != nil {
-		e := dutil.NewErr(500, "template", []string{"unable to execute template", err.Error()})
-		return e
-	}
+// PasswordResetRevokedMsg is the password reset revoked email.
+type PasswordResetRevokedMsg = Msg[*PasswordResetRevokedData]
+
+// NewPasswordResetRevokedMsg creates the password reset revoked email of
+// the brand b to the owner of the account in the locale.
+func NewPasswordResetRevokedMsg(to mail.Address, locale string, b config.Brand) *PasswordResetRevokedMsg {
+	msg := mustNewMsg("password-reset-revoked", locale, NewPasswordResetRevokedData(b))
+	msg.Message.To = append(msg.Message.To, to)
+	return msg
+}
 
-	xb, err := os.ReadFile(name)
-	if err != nil {
-		e := dutil.NewErr(500, "readFile", []string{"unable to read file", err.Error()})
-		return e
+// PasswordChangedData is the body of the notification to a user that the
+// password of the account was changed. A user who did not change the
+// password secures the account with the forgot password flow and reports
+// the change with the contact us form.
+type PasswordChangedData struct {
+	BrandData
+	ChangedAt          time.Time
+	ForgotPasswordLink string
+	ReportLink         string
+}
+
+// NewPasswordChangedData returns the password changed email body of the
+// change at the time with the brand b.
+func NewPasswordChangedData(changedAt time.Time, b config.Brand) *PasswordChangedData {
+	d := &PasswordChangedData{
+		BrandData: NewBrandData(b),
+		ChangedAt: changedAt.UTC(),
 	}
+	u := b.App.URL("/forgot-password")
+	d.ForgotPasswordLink = u.String()
+	u = b.App.URL("/contact-us")
+	u.RawQuery = url.Values{
+		"category":  []string{"account"},
+		"reference": []string{"password-changed"},
+	}.Encode()
+	d.ReportLink = u.String()
+	return d
+}
+
+// PasswordChangedMsg is the password changed email.
+type PasswordChangedMsg = Msg[*PasswordChangedData]
 
-	msg.Message.Body = string(xb)
-	//log.Printf("\n%s\n", msg.Message.Body)
-	return nil
+// NewPasswordChangedMsg creates the password changed email of the brand b
+// to the owner of the account in the locale.
+func NewPasswordChangedMsg(to mail.Address, changedAt time.Time, locale string, b config.Brand) *PasswordChangedMsg {
+	msg := mustNewMsg("password-changed", locale, NewPasswordChangedData(changedAt, b))
+	msg.Message.To = append(msg.Message.To, to)
+	return msg
 }
 
-// SendForgotPassword handles the execution of the forgot password HTML
-// template and then sends the email.
-func SendForgotPassword(msg ForgotPasswordMsg) dutil.Error {
-	// no token required for the email microservice at the moment (2022-04-17)
-	s := emailserv.NewService("")
-	return s.SendMail(msg.Message)
+// VerifyEmailData is the body of the email with the link to verify the
+// email of a registered user.
+type VerifyEmailData struct {
+	BrandData
+	Token           uuid.UUID
+	Expires         time.Time
+	VerifyEmailLink string
 }
 
-type ContactUsData struct {
-	Name          string
-	Email         string
-	Message       string
-	HomeLink      string
-	ContactUsLink string
-}
-type ContactUsMsg struct {
-	Message *emailserv.Message
-	Data    *ContactUsData
-}
-
-func NewContactUsMsg(replyTo mail.Address, message string) *ContactUsMsg {
-	scheme := os.Getenv("APP_SCHEME")
-	host := os.Getenv("APP_HOST")
-	u := url.URL{
-		Scheme: scheme,
-		Host:   host,
+// NewVerifyEmailData returns the verification email body with the link of
+// the brand b to verify the email with the token. The link is signed and
+// expires at the expiry.
+func NewVerifyEmailData(t uuid.UUID, expires time.Time, b config.Brand) *VerifyEmailData {
+	x := expires.Unix()
+	u := b.App.URL("/verify-email")
+	u.RawQuery = url.Values{
+		"t": []string{t.String()},
+		"e": []string{strconv.FormatInt(x, 10)},
+		"s": []string{SignVerifyEmailLink(t, x)},
+	}.Encode()
+	d := &VerifyEmailData{
+		BrandData:       NewBrandData(b),
+		Token:           t,
+		Expires:         time.Unix(x, 0).UTC(),
+		VerifyEmailLink: u.String(),
 	}
+	return d
+}
+
+// VerifyEmailMsg is the verification email.
+type VerifyEmailMsg = Msg[*VerifyEmailData]
+
+// NewVerifyEmailMsg creates the verification email of the brand b to the
+// registered user in the locale. The link expires after the link TTL of
+// the configuration.
+func NewVerifyEmailMsg(to mail.Address, t uuid.UUID, locale string, b config.Brand) *VerifyEmailMsg {
+	d := NewVerifyEmailData(t, time.Now().Add(conf.VerifyEmail.LinkTTL), b)
+	msg := mustNewMsg("verify-email", locale, d)
+	msg.Message.To = append(msg.Message.To, to)
+	return msg
+}
+
+type ContactUsData struct {
+	BrandData
+	Name      string
+	Email     string
+	Message   string
+	Category  string
+	Reference string
+}
+
+// NewContactUsData returns the contact us email body of the message from
+// the sender with the brand b.
+func NewContactUsData(b config.Brand, name, email, message string) *ContactUsData {
 	d := &ContactUsData{
-		Name:    replyTo.Name,
-		Email:   replyTo.Address,
-		Message: message,
-	}
-	// Home
-	u.Path = "/"
-	u.RawQuery = ""
-	d.HomeLink = u.String()
-	// Contact us
-	u.Path = "/contact-us"
-	u.RawQuery = ""
-	d.ContactUsLink = u.String()
-
-	return &ContactUsMsg{
-		Message: &emailserv.Message{
-			Headers: map[string][]string{
-				"Mime-Version": {"1.0"},
-				"Content-Type": {"text/html", "charset=UTF-8"},
-			},
-			From: mail.Address{
-				Name:    "Dottics Contact Us",
-				Address: "mail@dottics.com",
-			},
-			To: []mail.Address{
-				{Name: "Dottics Team", Address: "howzit@dottics.com"},
-			},
-			CC:      []mail.Address{replyTo},
-			ReplyTo: replyTo,
-			Subject: "Dottics Contact Us",
-		},
-		Data: d,
+		BrandData: NewBrandData(b),
+		Name:      name,
+		Email:     email,
+		Message:   message,
 	}
+	return d
 }
 
-func (msg *ContactUsMsg) ExecuteTemplate() dutil.Error {
-	tpl := loadTemplate()
-	wd := os.Getenv("WORKDIR")
-	u, err := uuid.NewUUID()
-	if err != nil {
-		e := dutil.NewErr(500, "uuid", []string{"unable to generate uuid", err.Error()})
-		return e
-	}
+// ContactUsMsg is the contact us email to the team.
+type ContactUsMsg = Msg[*ContactUsData]
 
-	name := path.Join(wd, "documents", fmt.Sprintf("contact-us-%s.html", u.String()))
-	file, err := os.Create(name)
-	if err != nil {
-		e := dutil.NewErr(500, "document", []string{"unable to create document", err.Error()})
-		return e
+// NewContactUsMsg creates the contact us email of the brand b with the
+// message of the payload p in the locale. The email is sent to the
+// recipients of the category of the message if it has a route and the
+// category is appended to the subject.
+func NewContactUsMsg(p *ContactUsMsgPayload, locale string, b config.Brand) *ContactUsMsg {
+	d := NewContactUsData(b, p.Name, p.Email, p.Message)
+	d.Category = p.Category
+	d.Reference = p.Reference
+	msg := mustNewMsg("contact-us", locale, d)
+	msg.Message.ReplyTo = p.Sender()
+	if p.Category != "" {
+		msg.Message.Subject = fmt.Sprintf("%s [%s]", msg.Message.Subject, p.Category)
 	}
-
-	err = tpl.ExecuteTemplate(file, "contact-us.html", msg.Data)
-	if err != nil {
-		e := dutil.NewErr(500, "template", []string{"unable to execute template", err.Error()})
-		return e
+	if to, ok := conf.ContactUs.Routes[p.Category]; ok {
+		msg.Message.To = append([]mail.Address{}, to...)
 	}
+	return msg
+}
 
-	xb, err := os.ReadFile(name)
-	if err != nil {
-		e := dutil.NewErr(500, "readFile", []string{"unable to read file", err.Error()})
-		return e
-	}
+// ContactUsAcknowledgementData is the body of the acknowledgement to the
+// sender of a contact us message. It does not repeat the name or message
+// of the sender, so that the form can not be abused to send arbitrary
+// content to an address.
+type ContactUsAcknowledgementData struct {
+	BrandData
+}
 
-	msg.Message.Body = string(xb)
-	return nil
+// NewContactUsAcknowledgementData returns the acknowledgement email body
+// with the brand b.
+func NewContactUsAcknowledgementData(b config.Brand) *ContactUsAcknowledgementData {
+	return &ContactUsAcknowledgementData{BrandData: NewBrandData(b)}
 }
 
-// SendMail will become a generic function to send an email via the
-// emailserv microservice package to the email microservice.
-func (msg *ContactUsMsg) SendMail() dutil.Error {
-	ms := emailserv.NewService("")
-	return ms.SendMail(msg.Message)
+// ContactUsAcknowledgementMsg is the acknowledgement email to the sender
+// of a contact us message.
+type ContactUsAcknowledgementMsg = Msg[*ContactUsAcknowledgementData]
+
+// NewContactUsAcknowledgementMsg creates the acknowledgement email of the
+// brand b to the sender to in the locale.
+func NewContactUsAcknowledgementMsg(to mail.Address, locale string, b config.Brand) *ContactUsAcknowledgementMsg {
+	msg := mustNewMsg("contact-us-acknowledgement", locale, NewContactUsAcknowledgementData(b))
+	msg.Message.To = append(msg.Message.To, to)
+	return msg
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/dottics/dutil"
 	"github.com/dottics/emailserv"
+	"github.com/dottics/flight-log-api-gateway/src/config"
 	"github.com/google/uuid"
 	"github.com/johannesscr/micro/microtest"
 	"net/mail"
@@ -11,15 +12,19 @@ import (
 	"path"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewForgotPasswordData(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
-	_ = os.Setenv("APP_SCHEME", "https")
-	_ = os.Setenv("APP_HOST", "test.dottics.com")
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
 
-	m := NewForgotPasswordData(uuid.MustParse("73730848-a9ed-4d25-9892-7948799cdc7a"))
+	m := NewForgotPasswordData(uuid.MustParse("73730848-a9ed-4d25-9892-7948799cdc7a"), testBrand)
 
 	resetPasswordLink := "https://test.dottics.com/reset-password?r=73730848-a9ed-4d25-9892-7948799cdc7a"
 	if m.ResetPasswordLink != resetPasswordLink {
@@ -41,16 +46,19 @@ func TestNewForgotPasswordData(t *testing.T) {
 
 func TestNewForgotPasswordMsg(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
-	_ = os.Setenv("APP_SCHEME", "https")
-	_ = os.Setenv("APP_HOST", "test.dottics.com")
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
 	to := mail.Address{
 		Name:    "James Bond",
 		Address: "james@bond.com",
 	}
 	token := uuid.MustParse("73730848-a9ed-4d25-9892-7948799cdc7a")
 
-	msg := NewForgotPasswordMsg(to, token)
+	msg := NewForgotPasswordMsg(to, token, "en", testBrand)
 	if msg.Message.To[0] != to {
 		t.Errorf("expected to address %v got %v", to, msg.Message.To[0])
 	}
@@ -65,15 +73,18 @@ func TestNewForgotPasswordMsg(t *testing.T) {
 
 func TestForgotPasswordMsg_ExecuteTemplate(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
-	_ = os.Setenv("APP_SCHEME", "https")
-	_ = os.Setenv("APP_HOST", "test.dottics.com")
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
 	to := mail.Address{
 		Name:    "James Bond",
 		Address: "james@bond.com",
 	}
 	token := uuid.MustParse("73730848-a9ed-4d25-9892-7948799cdc7a")
-	msg := NewForgotPasswordMsg(to, token)
+	msg := NewForgotPasswordMsg(to, token, "en", testBrand)
 	e := msg.ExecuteTemplate()
 	if e != nil {
 		t.Errorf("expected error %v got %v", nil, e)
@@ -81,14 +92,17 @@ func TestForgotPasswordMsg_ExecuteTemplate(t *testing.T) {
 	if len(msg.Message.Body) == 0 {
 		t.Errorf("expected body length %d > 0", len(msg.Message.Body))
 	}
-	if !strings.Contains(msg.Message.Body, msg.Data.ResetPasswordLink) {
+	if !strings.Contains(msg.HTML, msg.Data.ResetPasswordLink) || !strings.Contains(msg.Text, msg.Data.ResetPasswordLink) {
 		t.Errorf("expected template to execute and contain %s", msg.Data.ResetPasswordLink)
 	}
+	if msg.Message.Headers.Get("Content-Type") != "multipart/alternative" {
+		t.Errorf("expected content type '%s' got '%s'", "multipart/alternative", msg.Message.Headers.Get("Content-Type"))
+	}
 }
 
-func TestSendForgotPassword(t *testing.T) {
+func TestForgotPasswordMsg_SendMail(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
 	tests := []struct {
 		name     string
 		msg      ForgotPasswordMsg
@@ -166,7 +180,7 @@ func TestSendForgotPassword(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			ms.Append(tc.exchange)
 
-			e := SendForgotPassword(tc.msg)
+			e := tc.msg.SendMail()
 			if !dutil.ErrorEqual(e, tc.e) {
 				t.Errorf("expected error %v got %v", tc.e, e)
 			}
@@ -176,9 +190,18 @@ func TestSendForgotPassword(t *testing.T) {
 
 func TestNewContactUsMsg(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
-	_ = os.Setenv("APP_SCHEME", "https")
-	_ = os.Setenv("APP_HOST", "test.dottics.com")
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+		ContactUs: config.ContactUs{
+			Categories: []string{"account", "billing"},
+			Routes: map[string][]mail.Address{
+				"billing": {{Name: "Dottics Billing", Address: "billing@dottics.com"}},
+			},
+		},
+	})
 	to := mail.Address{
 		Name:    "James Bond",
 		Address: "james@bond.com",
@@ -186,27 +209,57 @@ func TestNewContactUsMsg(t *testing.T) {
 	message := "Hi there,\n\nCan I please be in the closed review for the budget app\n\n" +
 		"I am still new to budgeting.\n\nRegards\nJames Bond"
 
-	msg := NewContactUsMsg(to, message)
-
-	if msg.Data.HomeLink != "https://test.dottics.com/" {
-		t.Errorf("expected home link '%s' got '%s'", "https://test.dottics.com/", msg.Data.HomeLink)
-	}
-	if msg.Data.Name != to.Name {
-		t.Errorf("expected name '%s' got '%s'", to.Name, msg.Data.Name)
-	}
-	if msg.Data.Email != to.Address {
-		t.Errorf("expected name '%s' got '%s'", to.Address, msg.Data.Email)
+	tests := []struct {
+		name      string
+		category  string
+		reference string
+		subject   string
+		to        string
+	}{
+		{name: "no category", subject: "Dottics Contact Us", to: "howzit@dottics.com"},
+		{name: "category without route", category: "account", subject: "Dottics Contact Us [account]", to: "howzit@dottics.com"},
+		{name: "routed category", category: "billing", reference: "INV-42", subject: "Dottics Contact Us [billing]", to: "billing@dottics.com"},
 	}
-	if msg.Data.Message != message {
-		t.Errorf("expected message '%s' got %s'", message, msg.Data.Message)
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			p := &ContactUsMsgPayload{Name: to.Name, Email: to.Address, Message: message, Category: tc.category, Reference: tc.reference}
+			msg := NewContactUsMsg(p, "en", testBrand)
+
+			if msg.Data.HomeLink != "https://test.dottics.com/" {
+				t.Errorf("expected home link '%s' got '%s'", "https://test.dottics.com/", msg.Data.HomeLink)
+			}
+			if msg.Data.Name != to.Name || msg.Data.Email != to.Address || msg.Data.Message != message {
+				t.Errorf("expected the sender and message got %v", msg.Data)
+			}
+			if msg.Data.Category != tc.category || msg.Data.Reference != tc.reference {
+				t.Errorf("expected category '%s' and reference '%s' got '%s' and '%s'", tc.category, tc.reference, msg.Data.Category, msg.Data.Reference)
+			}
+			if msg.Message.Subject != tc.subject {
+				t.Errorf("expected subject '%s' got '%s'", tc.subject, msg.Message.Subject)
+			}
+			if len(msg.Message.To) != 1 || msg.Message.To[0].Address != tc.to {
+				t.Errorf("expected to %s got %v", tc.to, msg.Message.To)
+			}
+			if msg.Message.ReplyTo != to {
+				t.Errorf("expected reply-to %v got %v", to, msg.Message.ReplyTo)
+			}
+			if len(msg.Message.CC) != 0 {
+				t.Errorf("expected the sender not to be CC'd got %v", msg.Message.CC)
+			}
+		})
 	}
 }
 
 func TestContactUsMsg_ExecuteTemplate(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
-	_ = os.Setenv("APP_SCHEME", "https")
-	_ = os.Setenv("APP_HOST", "test.dottics.com")
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
 	to := mail.Address{
 		Name:    "James Bond",
 		Address: "james@bond.com",
@@ -214,7 +267,8 @@ func TestContactUsMsg_ExecuteTemplate(t *testing.T) {
 	message := "Hi there,\n\nCan I please be in the closed review for the budget app\n\n" +
 		"I am still new to budgeting.\n\nRegards\nJames Bond"
 
-	msg := NewContactUsMsg(to, message)
+	p := &ContactUsMsgPayload{Name: to.Name, Email: to.Address, Message: message, Category: "billing", Reference: "INV-42"}
+	msg := NewContactUsMsg(p, "en", testBrand)
 	e := msg.ExecuteTemplate()
 	if e != nil {
 		t.Errorf("expected error %v got %v", nil, e)
@@ -222,14 +276,20 @@ func TestContactUsMsg_ExecuteTemplate(t *testing.T) {
 	if len(msg.Message.Body) == 0 {
 		t.Errorf("expected body length %d > 0", len(msg.Message.Body))
 	}
-	if !strings.Contains(msg.Message.Body, msg.Data.Message) {
+	if !strings.Contains(msg.HTML, msg.Data.Message) {
 		t.Errorf("expected template to execute and contain %s", msg.Data.Message)
 	}
+	if !strings.Contains(msg.Text, "I am still new to budgeting.") {
+		t.Errorf("expected the plain text to contain the message got %s", msg.Text)
+	}
+	if !strings.Contains(msg.Text, "Category: billing\nReference: INV-42\n") || !strings.Contains(msg.HTML, "INV-42") {
+		t.Errorf("expected the category and reference got %s", msg.Text)
+	}
 }
 
 func TestContactUsMsg_SendMail(t *testing.T) {
 	wd, _ := os.Getwd()
-	_ = os.Setenv("WORKDIR", path.Join(wd, "../.."))
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
 	tests := []struct {
 		name     string
 		msg      ContactUsMsg
@@ -296,3 +356,88 @@ func TestContactUsMsg_SendMail(t *testing.T) {
 		})
 	}
 }
+
+func TestNewContactUsAcknowledgementMsg(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
+	to := mail.Address{
+		Name:    "James Bond",
+		Address: "james@bond.com",
+	}
+
+	msg := NewContactUsAcknowledgementMsg(to, "af", testBrand)
+	if len(msg.Message.To) != 1 || msg.Message.To[0] != to {
+		t.Errorf("expected to address %v got %v", to, msg.Message.To)
+	}
+	if msg.Message.Subject != "Dottics Ons het jou Boodskap Ontvang" {
+		t.Errorf("expected subject '%s' got '%s'", "Dottics Ons het jou Boodskap Ontvang", msg.Message.Subject)
+	}
+	e := msg.ExecuteTemplate()
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if !strings.Contains(msg.Text, "Ons het jou boodskap ontvang.") || !strings.Contains(msg.HTML, msg.Data.ContactUsLink) {
+		t.Errorf("expected the acknowledgement to execute got %s", msg.Text)
+	}
+}
+
+func TestNewPasswordResetRevokedMsg(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
+	to := mail.Address{Address: "james@bond.com"}
+
+	msg := NewPasswordResetRevokedMsg(to, "de", testBrand)
+	if len(msg.Message.To) != 1 || msg.Message.To[0] != to {
+		t.Errorf("expected to address %v got %v", to, msg.Message.To)
+	}
+	if msg.Message.Subject != "Dottics Zurücksetzen des Passworts widerrufen" {
+		t.Errorf("expected subject '%s' got '%s'", "Dottics Zurücksetzen des Passworts widerrufen", msg.Message.Subject)
+	}
+	e := msg.ExecuteTemplate()
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if !strings.Contains(msg.Text, "Ihr Passwort wurde nicht geändert") || !strings.Contains(msg.HTML, msg.Data.ContactUsLink) {
+		t.Errorf("expected the notification to execute got %s", msg.Text)
+	}
+}
+
+func TestNewPasswordChangedMsg(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
+	to := mail.Address{Name: "James Bond", Address: "james@bond.com"}
+	changedAt := time.Date(2023, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	msg := NewPasswordChangedMsg(to, changedAt, "en", testBrand)
+	if len(msg.Message.To) != 1 || msg.Message.To[0] != to {
+		t.Errorf("expected to address %v got %v", to, msg.Message.To)
+	}
+	if msg.Message.Subject != "Dottics Password Changed" {
+		t.Errorf("expected subject '%s' got '%s'", "Dottics Password Changed", msg.Message.Subject)
+	}
+	if !strings.HasSuffix(msg.Data.ForgotPasswordLink, "/forgot-password") || !strings.HasSuffix(msg.Data.ReportLink, "/contact-us?category=account&reference=password-changed") {
+		t.Errorf("expected the forgot password and report links got %s and %s", msg.Data.ForgotPasswordLink, msg.Data.ReportLink)
+	}
+	e := msg.ExecuteTemplate()
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if !strings.Contains(msg.Text, "changed at 2023-01-01 12:30 UTC") || !strings.Contains(msg.Text, msg.Data.ReportLink) {
+		t.Errorf("expected the notification to execute got %s", msg.Text)
+	}
+}
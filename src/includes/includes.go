@@ -0,0 +1,96 @@
+package includes
+
+import (
+	"context"
+	"github.com/dottics/emailserv"
+	"github.com/dottics/flight-log-api-gateway/src/audit"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	"log"
+)
+
+// conf is the configuration of the gateway used by the exchanges and
+// emails of the includes package.
+var conf = &config.Config{}
+
+// Configure sets the configuration used by the includes package and parses
+// the email templates of every locale from the working directory. It is called once at
+// startup when the server is created. An error is returned if a registered
+// template has no sender or recipients in the configuration.
+func Configure(c *config.Config) error {
+	err := checkTemplates(c)
+	if err != nil {
+		return err
+	}
+	tpl, txt, err := loadTemplates(c.WorkDir, c.DefaultLocale)
+	if err != nil {
+		return err
+	}
+	conf = c
+	templates = tpl
+	textTemplates = txt
+	return nil
+}
+
+// Queue persists emails for asynchronous delivery.
+type Queue interface {
+	Enqueue(m *emailserv.Message) error
+}
+
+// queue is the queue of the emails, emails are sent synchronously when
+// there is no queue.
+var queue Queue
+
+// UseQueue sets the queue to which the emails are sent, nil sends the
+// emails synchronously.
+func UseQueue(q Queue) {
+	queue = q
+}
+
+// limiter limits how often an email is sent to an address, emails are not
+// limited when there is no limiter.
+var limiter ratelimit.Store
+
+// UseLimiter sets the store of the rate limits of the emails, nil does not
+// limit the emails.
+func UseLimiter(l ratelimit.Store) {
+	limiter = l
+}
+
+// suppressions are the addresses to which emails are not sent, emails are
+// sent to every address when there are no suppressions.
+var suppressions suppression.Store
+
+// UseSuppressions sets the store of the suppressed addresses, nil sends the
+// emails to every address.
+func UseSuppressions(s suppression.Store) {
+	suppressions = s
+}
+
+// recorder records the security relevant events of the accounts, events
+// are not recorded when there is no recorder.
+var recorder audit.Recorder
+
+// UseRecorder sets the recorder of the events, nil does not record the
+// events.
+func UseRecorder(r audit.Recorder) {
+	recorder = r
+}
+
+// RecordEvent records the event, a failure to record the event is logged.
+func RecordEvent(ctx context.Context, e audit.Event) {
+	if recorder == nil {
+		return
+	}
+	err := recorder.Record(ctx, e)
+	if err != nil {
+		log.Printf("audit: unable to record %s of %s: %v", e.Type, MaskEmail(e.Email), err)
+	}
+}
+
+// MaskEmail masks the local part of the email address so that the address
+// can be logged, see audit.MaskEmail.
+func MaskEmail(email string) string {
+	return audit.MaskEmail(email)
+}
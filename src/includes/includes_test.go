@@ -0,0 +1,49 @@
+package includes
+
+import (
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"net/mail"
+	"os"
+	"path"
+	"testing"
+)
+
+// testEmail is the email configuration of the tests.
+var testEmail = config.Email{
+	From: mail.Address{Name: "No-Reply Dottics", Address: "mail@dottics.com"},
+	Templates: map[string]config.EmailTemplate{
+		"contact-us": {To: []mail.Address{{Name: "Dottics Team", Address: "howzit@dottics.com"}}},
+	},
+}
+
+// testBrand is the brand of the tests.
+var testBrand = config.Brand{
+	Name:   "Flight Log",
+	Colors: config.BrandColors{Primary: "#369deb", Secondary: "#54d6fe"},
+	App:    config.Service{Scheme: "https", Host: "test.dottics.com"},
+}
+
+func TestConfigure(t *testing.T) {
+	err := Configure(&config.Config{WorkDir: t.TempDir(), DefaultLocale: "en", Email: testEmail})
+	if err == nil {
+		t.Errorf("expected an error for a working directory without templates")
+	}
+
+	wd, _ := os.Getwd()
+	err = Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	if err != nil {
+		t.Errorf("expected error %v got %v", nil, err)
+	}
+	for _, locale := range []string{"af", "de", "en"} {
+		for _, name := range []string{"forgot-password.html", "contact-us.html"} {
+			if templates[locale].Lookup(name) == nil {
+				t.Errorf("expected template %s/%s to be parsed", locale, name)
+			}
+		}
+	}
+
+	err = Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "fr", Email: testEmail})
+	if err == nil {
+		t.Errorf("expected an error for a default locale without templates")
+	}
+}
@@ -0,0 +1,84 @@
+package includes
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseAcceptLanguage parses the Accept-Language header h and returns the
+// language tags in order of preference. Tags with a quality of 0 and the
+// wildcard are excluded.
+func ParseAcceptLanguage(h string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	xt := make([]tag, 0)
+	for _, s := range strings.Split(h, ",") {
+		xs := strings.Split(strings.TrimSpace(s), ";")
+		name := strings.TrimSpace(xs[0])
+		if name == "" || name == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range xs[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		xt = append(xt, tag{name: name, q: q})
+	}
+	sort.SliceStable(xt, func(i, j int) bool {
+		return xt[i].q > xt[j].q
+	})
+	tags := make([]string, len(xt))
+	for i, t := range xt {
+		tags[i] = t.name
+	}
+	return tags
+}
+
+// normalizeLocale returns the lower-case locale with "-" as separator such
+// that "de_CH" and "de-ch" are the same locale.
+func normalizeLocale(s string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "_", "-"))
+}
+
+// ResolveLocale returns the first of the preferred locales for which there
+// are templates. The fallback chain of each preference is the locale
+// itself followed by its base language, for example "de-ch" then "de".
+// The default locale is returned if none of the preferences has templates.
+func ResolveLocale(preferences ...string) string {
+	for _, p := range preferences {
+		l := normalizeLocale(p)
+		for l != "" {
+			if _, ok := templates[l]; ok {
+				return l
+			}
+			i := strings.LastIndex(l, "-")
+			if i < 0 {
+				break
+			}
+			l = l[:i]
+		}
+	}
+	return conf.DefaultLocale
+}
+
+// Locales returns the sorted locales for which there are templates.
+func Locales() []string {
+	xs := make([]string, 0, len(templates))
+	for l := range templates {
+		xs = append(xs, l)
+	}
+	sort.Strings(xs)
+	return xs
+}
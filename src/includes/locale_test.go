@@ -0,0 +1,69 @@
+package includes
+
+import (
+	"fmt"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		tags   []string
+	}{
+		{name: "empty", header: "", tags: []string{}},
+		{name: "single", header: "de", tags: []string{"de"}},
+		{name: "ordered by quality", header: "en;q=0.5, de-CH, de;q=0.9", tags: []string{"de-CH", "de", "en"}},
+		{name: "equal quality keeps order", header: "af, en", tags: []string{"af", "en"}},
+		{name: "wildcard and zero quality excluded", header: "fr;q=0, *;q=0.1, en;q=0.8", tags: []string{"en"}},
+		{name: "invalid quality is 1", header: "de;q=abc, en;q=0.9", tags: []string{"de", "en"}},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			tags := ParseAcceptLanguage(tc.header)
+			if strings.Join(tags, ",") != strings.Join(tc.tags, ",") {
+				t.Errorf("expected tags %v got %v", tc.tags, tags)
+			}
+		})
+	}
+}
+
+func TestResolveLocale(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	tests := []struct {
+		name        string
+		preferences []string
+		locale      string
+	}{
+		{name: "no preference", preferences: []string{}, locale: "en"},
+		{name: "empty preference", preferences: []string{""}, locale: "en"},
+		{name: "exact", preferences: []string{"de"}, locale: "de"},
+		{name: "case and separator", preferences: []string{"AF_za"}, locale: "af"},
+		{name: "base language", preferences: []string{"de-CH"}, locale: "de"},
+		{name: "first available preference", preferences: []string{"fr", "af", "de"}, locale: "af"},
+		{name: "no templates falls back to default", preferences: []string{"fr-FR", "zu"}, locale: "en"},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			locale := ResolveLocale(tc.preferences...)
+			if locale != tc.locale {
+				t.Errorf("expected locale '%s' got '%s'", tc.locale, locale)
+			}
+		})
+	}
+
+	xs := Locales()
+	if strings.Join(xs, ",") != "af,de,en" {
+		t.Errorf("expected locales %v got %v", []string{"af", "de", "en"}, xs)
+	}
+}
@@ -0,0 +1,82 @@
+package includes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"reflect"
+)
+
+// Preview is a rendered email which is not sent, used to design the
+// templates.
+type Preview struct {
+	Template string `json:"template"`
+	Locale   string `json:"locale"`
+	Subject  string `json:"subject"`
+	HTML     string `json:"html"`
+	Text     string `json:"text"`
+}
+
+// NewPreview renders the registered template name in the locale with its
+// sample data of the brand b. The fields of the JSON object data, if any,
+// replace the fields of the sample data.
+func NewPreview(name, locale string, b config.Brand, data []byte) (*Preview, dutil.Error) {
+	t, ok := Lookup(name)
+	if !ok {
+		e := dutil.NewErr(404, "template", []string{fmt.Sprintf("template %s not registered", name)})
+		return nil, e
+	}
+	d, e := sampleData(t, b, data)
+	if e != nil {
+		return nil, e
+	}
+	msg, e := NewMsg(name, locale, d)
+	if e != nil {
+		return nil, e
+	}
+	e = msg.ExecuteTemplate()
+	if e != nil {
+		return nil, e
+	}
+	p := &Preview{
+		Template: name,
+		Locale:   msg.Locale,
+		Subject:  msg.Message.Subject,
+		HTML:     msg.HTML,
+		Text:     msg.Text,
+	}
+	return p, nil
+}
+
+// sampleData returns the sample data of the template t for the brand b
+// with the fields of the JSON object data decoded over it.
+func sampleData(t *Template, b config.Brand, data []byte) (interface{}, dutil.Error) {
+	rt := reflect.TypeOf(t.Data)
+	v := reflect.New(rt)
+	if t.Sample != nil {
+		d := t.Sample(b)
+		if reflect.TypeOf(d) != rt {
+			e := dutil.NewErr(500, "template", []string{
+				fmt.Sprintf("template %s sample requires data %T got %T", t.Name, t.Data, d),
+			})
+			return nil, e
+		}
+		v.Elem().Set(reflect.ValueOf(d))
+	} else if rt.Kind() == reflect.Ptr {
+		v.Elem().Set(reflect.New(rt.Elem()))
+	}
+	if len(data) > 0 {
+		if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			e := dutil.NewErr(400, "data", []string{"data must be a JSON object"})
+			return nil, e
+		}
+		err := json.Unmarshal(data, v.Interface())
+		if err != nil {
+			e := dutil.NewErr(400, "data", []string{"unable to decode data", err.Error()})
+			return nil, e
+		}
+	}
+	return v.Elem().Interface(), nil
+}
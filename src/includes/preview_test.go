@@ -0,0 +1,110 @@
+package includes
+
+import (
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestNewPreview(t *testing.T) {
+	wd, _ := os.Getwd()
+	err := Configure(&config.Config{
+		WorkDir:       path.Join(wd, "../.."),
+		DefaultLocale: "en",
+		Email:         testEmail,
+		App:           config.Service{Scheme: "https", Host: "test.dottics.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type E struct {
+		locale   string
+		subject  string
+		contains string
+		e        dutil.Error
+	}
+	tests := []struct {
+		name     string
+		template string
+		locale   string
+		data     string
+		E        E
+	}{
+		{
+			name:     "not registered",
+			template: "welcome",
+			E: E{
+				e: dutil.NewErr(404, "template", []string{"template welcome not registered"}),
+			},
+		},
+		{
+			name:     "sample data",
+			template: "contact-us",
+			locale:   "en",
+			E: E{
+				locale:   "en",
+				subject:  "Dottics Contact Us",
+				contains: "James Bond",
+			},
+		},
+		{
+			name:     "data replaces the sample",
+			template: "contact-us",
+			locale:   "de-CH",
+			data:     `{"Name":"Miss Moneypenny"}`,
+			E: E{
+				locale:   "de",
+				subject:  "Dottics Kontakt",
+				contains: "Miss Moneypenny",
+			},
+		},
+		{
+			name:     "forgot password sample",
+			template: "forgot-password",
+			E: E{
+				locale:   "en",
+				subject:  "Dottics Forgot Password",
+				contains: "https://test.dottics.com/reset-password?r=",
+			},
+		},
+		{
+			name:     "data is not an object",
+			template: "contact-us",
+			data:     `null`,
+			E: E{
+				e: dutil.NewErr(400, "data", []string{"data must be a JSON object"}),
+			},
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			var data []byte
+			if tc.data != "" {
+				data = []byte(tc.data)
+			}
+			p, e := NewPreview(tc.template, tc.locale, testBrand, data)
+			if !dutil.ErrorEqual(tc.E.e, e) {
+				t.Fatalf("expected error %v got %v", tc.E.e, e)
+			}
+			if e != nil {
+				return
+			}
+			if p.Locale != tc.E.locale {
+				t.Errorf("expected locale %q got %q", tc.E.locale, p.Locale)
+			}
+			if p.Subject != tc.E.subject {
+				t.Errorf("expected subject %q got %q", tc.E.subject, p.Subject)
+			}
+			if !strings.Contains(p.HTML, tc.E.contains) || !strings.Contains(p.Text, tc.E.contains) {
+				t.Errorf("expected html and text to contain %q", tc.E.contains)
+			}
+		})
+	}
+}
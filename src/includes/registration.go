@@ -0,0 +1,153 @@
+package includes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/dottics/dutil"
+	security "github.com/dottics/securityserv"
+	"github.com/google/uuid"
+	"io"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate validates the registration and returns the errors by field.
+// The password policy is enforced by the security microservice.
+func (p *RegisterPayload) Validate() map[string][]string {
+	errs := make(map[string][]string)
+	if strings.TrimSpace(p.FirstName) == "" {
+		errs["first_name"] = []string{"required"}
+	}
+	if strings.TrimSpace(p.LastName) == "" {
+		errs["last_name"] = []string{"required"}
+	}
+	a, err := mail.ParseAddress(strings.TrimSpace(p.Email))
+	if strings.TrimSpace(p.Email) == "" {
+		errs["email"] = []string{"required"}
+	} else if err != nil || a.Name != "" {
+		errs["email"] = []string{"invalid address"}
+	}
+	if p.Password == "" {
+		errs["password"] = []string{"required"}
+	}
+	return errs
+}
+
+// RegisterUser handles the exchange with the security microservice to create
+// the account of a new user. The user is created unverified.
+func RegisterUser(p RegisterPayload) (security.User, dutil.Error) {
+	data := struct {
+		User security.User `json:"user"`
+	}{}
+	p.Locale = ""
+	e := securityExchange("", "POST", "/register", p, 201, &data)
+	if e != nil {
+		return security.User{}, e
+	}
+	return data.User, nil
+}
+
+// EmailVerificationToken handles the exchange with the security
+// microservice to generate the email verification token of the user with
+// the email.
+func EmailVerificationToken(email string) (uuid.UUID, dutil.Error) {
+	data := struct {
+		EmailVerificationToken string `json:"email_verification_token"`
+	}{}
+	p := map[string]string{"email": email}
+	e := securityExchange("", "POST", "/verify-email/token", p, 200, &data)
+	if e != nil {
+		return uuid.UUID{}, e
+	}
+	t, err := uuid.Parse(data.EmailVerificationToken)
+	if err != nil {
+		e := dutil.NewErr(500, "uuid", []string{err.Error()})
+		return uuid.UUID{}, e
+	}
+	return t, nil
+}
+
+// VerifyEmail handles the exchange with the security microservice to
+// verify the email of the user with the email verification token.
+func VerifyEmail(t uuid.UUID) dutil.Error {
+	p := map[string]string{"email_verification_token": t.String()}
+	return securityExchange("", "POST", "/verify-email/verify", p, 200, nil)
+}
+
+// securityExchange sends the payload to the path of the security
+// microservice with the token of the user, if any, and decodes the data of
+// the response into v. The path may have a query and a nil payload sends
+// no body. An error is returned if the status of the response is not the
+// status.
+func securityExchange(token, method, path string, payload interface{}, status int, v interface{}) dutil.Error {
+	s := security.NewService(token)
+	u, err := url.Parse(path)
+	if err != nil {
+		e := dutil.NewErr(500, "url", []string{err.Error()})
+		return e
+	}
+	s.URL.Path = u.Path
+	s.URL.RawQuery = u.RawQuery
+
+	resp := struct {
+		Message string              `json:"message"`
+		Data    interface{}         `json:"data"`
+		Errors  map[string][]string `json:"errors"`
+	}{Data: v}
+
+	var body io.Reader
+	if payload != nil {
+		var e dutil.Error
+		body, e = dutil.MarshalReader(payload)
+		if e != nil {
+			return e
+		}
+	}
+	res, e := s.NewRequest(method, s.URL.String(), nil, body)
+	if e != nil {
+		return e
+	}
+	e = decode(res.Body, &resp)
+	if e != nil {
+		return e
+	}
+
+	if res.StatusCode != status {
+		e := &dutil.Err{
+			Status: res.StatusCode,
+			Errors: resp.Errors,
+		}
+		return e
+	}
+	return nil
+}
+
+// SignVerifyEmailLink returns the signature of the email verification
+// link of the token which expires at the unix time.
+func SignVerifyEmailLink(t uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(conf.VerifyEmail.Secret))
+	mac.Write([]byte(t.String() + "." + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckVerifyEmailLink checks the signature and the expiry of the email
+// verification link of the token, so that a link which was tampered with
+// or has expired is refused without an exchange with the security
+// microservice.
+func CheckVerifyEmailLink(t uuid.UUID, expires int64, signature string) dutil.Error {
+	expected := SignVerifyEmailLink(t, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		e := dutil.NewErr(400, "signature", []string{"invalid signature"})
+		return e
+	}
+	if time.Now().Unix() > expires {
+		e := dutil.NewErr(400, "expires", []string{fmt.Sprintf("link expired at %s", time.Unix(expires, 0).UTC().Format(time.RFC3339))})
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package includes
+
+import (
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/google/uuid"
+	"github.com/johannesscr/micro/microtest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRegisterPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		p    RegisterPayload
+		E    string
+	}{
+		{
+			name: "empty",
+			p:    RegisterPayload{},
+			E:    "map[email:[required] first_name:[required] last_name:[required] password:[required]]",
+		},
+		{
+			name: "invalid address",
+			p:    RegisterPayload{FirstName: "James", LastName: "Bond", Email: "James Bond <james@bond.com>", Password: "007"},
+			E:    "map[email:[invalid address]]",
+		},
+		{
+			name: "valid",
+			p:    RegisterPayload{FirstName: "James", LastName: "Bond", Email: "james@bond.com", Password: "007"},
+			E:    "map[]",
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			errs := tc.p.Validate()
+			if fmt.Sprint(errs) != tc.E {
+				t.Errorf("expected errors %s got %v", tc.E, errs)
+			}
+		})
+	}
+}
+
+func TestRegisterUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange *microtest.Exchange
+		email    string
+		e        dutil.Error
+	}{
+		{
+			name: "email exists",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 400,
+					Body:   `{"message":"BadRequest","data":null,"errors":{"email":["already exists"]}}`,
+				},
+			},
+			e: dutil.NewErr(400, "email", []string{"already exists"}),
+		},
+		{
+			name: "registered",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 201,
+					Body:   `{"message":"user created","data":{"user":{"uuid":"3d9579de-162f-450a-8a7a-0cde0305d530","first_name":"James","last_name":"Bond","email":"james@bond.com"}},"errors":null}`,
+				},
+			},
+			email: "james@bond.com",
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			user, e := RegisterUser(RegisterPayload{FirstName: "James", LastName: "Bond", Email: "james@bond.com", Password: "007"})
+			req := tc.exchange.Request
+			if req == nil || req.Method != "POST" || req.URL.Path != "/register" {
+				t.Errorf("expected a POST to %s got %v", "/register", req)
+			}
+			if !dutil.ErrorEqual(e, tc.e) {
+				t.Errorf("expected error %v got %v", tc.e, e)
+			}
+			if user.Email != tc.email {
+				t.Errorf("expected user '%s' got '%s'", tc.email, user.Email)
+			}
+		})
+	}
+}
+
+func TestEmailVerificationToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange *microtest.Exchange
+		token    uuid.UUID
+		e        dutil.Error
+	}{
+		{
+			name: "user not found",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 400,
+					Body:   `{"message":"BadRequest","data":null,"errors":{"user":["not found"]}}`,
+				},
+			},
+			e: dutil.NewErr(400, "user", []string{"not found"}),
+		},
+		{
+			name: "invalid token",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"token","data":{"email_verification_token":"abc"},"errors":null}`,
+				},
+			},
+			e: dutil.NewErr(500, "uuid", []string{"invalid UUID length: 3"}),
+		},
+		{
+			name: "token",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"token","data":{"email_verification_token":"3d9579de-162f-450a-8a7a-0cde0305d530"},"errors":null}`,
+				},
+			},
+			token: uuid.MustParse("3d9579de-162f-450a-8a7a-0cde0305d530"),
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			token, e := EmailVerificationToken("james@bond.com")
+			req := tc.exchange.Request
+			if req == nil || req.URL.Path != "/verify-email/token" {
+				t.Errorf("expected a request to %s got %v", "/verify-email/token", req)
+			}
+			if !dutil.ErrorEqual(e, tc.e) {
+				t.Errorf("expected error %v got %v", tc.e, e)
+			}
+			if token != tc.token {
+				t.Errorf("expected token %s got %s", tc.token, token)
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange *microtest.Exchange
+		e        dutil.Error
+	}{
+		{
+			name: "token not found",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 404,
+					Body:   `{"message":"NotFound","data":null,"errors":{"email_verification_token":["not found"]}}`,
+				},
+			},
+			e: dutil.NewErr(404, "email_verification_token", []string{"not found"}),
+		},
+		{
+			name: "verified",
+			exchange: &microtest.Exchange{
+				Response: microtest.Response{
+					Status: 200,
+					Body:   `{"message":"email verified","data":null,"errors":null}`,
+				},
+			},
+		},
+	}
+
+	ms := microtest.NewMockServer("SECURITY_SERVICE_SCHEME", "SECURITY_SERVICE_HOST")
+	defer ms.Server.Close()
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			ms.Append(tc.exchange)
+
+			e := VerifyEmail(uuid.MustParse("3d9579de-162f-450a-8a7a-0cde0305d530"))
+			req := tc.exchange.Request
+			if req == nil || req.URL.Path != "/verify-email/verify" {
+				t.Errorf("expected a request to %s got %v", "/verify-email/verify", req)
+			}
+			if !dutil.ErrorEqual(e, tc.e) {
+				t.Errorf("expected error %v got %v", tc.e, e)
+			}
+		})
+	}
+}
+
+func TestCheckVerifyEmailLink(t *testing.T) {
+	defer func(c *config.Config) { conf = c }(conf)
+	conf = &config.Config{VerifyEmail: config.VerifyEmail{Secret: "s3cret", LinkTTL: time.Hour}}
+
+	token := uuid.MustParse("3d9579de-162f-450a-8a7a-0cde0305d530")
+	future := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name      string
+		token     uuid.UUID
+		expires   int64
+		signature string
+		e         dutil.Error
+	}{
+		{
+			name:      "invalid signature",
+			token:     token,
+			expires:   future,
+			signature: "abc",
+			e:         dutil.NewErr(400, "signature", []string{"invalid signature"}),
+		},
+		{
+			name:      "extended expiry",
+			token:     token,
+			expires:   future + 3600,
+			signature: SignVerifyEmailLink(token, future),
+			e:         dutil.NewErr(400, "signature", []string{"invalid signature"}),
+		},
+		{
+			name:      "expired",
+			token:     token,
+			expires:   1672531200,
+			signature: SignVerifyEmailLink(token, 1672531200),
+			e:         dutil.NewErr(400, "expires", []string{"link expired at 2023-01-01T00:00:00Z"}),
+		},
+		{
+			name:      "valid",
+			token:     token,
+			expires:   future,
+			signature: SignVerifyEmailLink(token, future),
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			e := CheckVerifyEmailLink(tc.token, tc.expires, tc.signature)
+			if !dutil.ErrorEqual(e, tc.e) {
+				t.Errorf("expected error %v got %v", tc.e, e)
+			}
+		})
+	}
+}
+
+func TestNewVerifyEmailData(t *testing.T) {
+	defer func(c *config.Config) { conf = c }(conf)
+	conf = &config.Config{VerifyEmail: config.VerifyEmail{Secret: "s3cret", LinkTTL: time.Hour}}
+
+	token := uuid.MustParse("3d9579de-162f-450a-8a7a-0cde0305d530")
+	expires := time.Now().Add(time.Hour)
+	b := config.Brand{Name: "Flight Log", App: config.Service{Scheme: "https", Host: "flight-log.dottics.com"}}
+	d := NewVerifyEmailData(token, expires, b)
+
+	u, err := url.Parse(d.VerifyEmailLink)
+	if err != nil || u.Host != "flight-log.dottics.com" || u.Path != "/verify-email" {
+		t.Fatalf("expected a link to %s got %s", "https://flight-log.dottics.com/verify-email", d.VerifyEmailLink)
+	}
+	q := u.Query()
+	x, _ := strconv.ParseInt(q.Get("e"), 10, 64)
+	if q.Get("t") != token.String() || x != expires.Unix() {
+		t.Errorf("expected the token %s expiring at %d got %v", token, expires.Unix(), q)
+	}
+	if e := CheckVerifyEmailLink(token, x, q.Get("s")); e != nil {
+		t.Errorf("expected a valid signature got %v", e)
+	}
+}
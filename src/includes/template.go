@@ -0,0 +1,467 @@
+package includes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/emailserv"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	"github.com/google/uuid"
+	"html/template"
+	"log"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template is a transactional email registered by name. The template
+// declares the type of its data, its subject, sender and the recipients
+// which do not depend on the request. The configuration of the template,
+// see config.EmailTemplate, replaces the subject, sender and recipients
+// which are set.
+type Template struct {
+	// Name is the name of the template, the HTML template is
+	// templates/<locale>/<name>.html and the optional plain-text template
+	// is templates/<locale>/<name>.txt.
+	Name string
+	// Subject is the subject of the default locale and Subjects the
+	// subject by locale.
+	Subject  string
+	Subjects map[string]string
+	// From defaults to the configured sender.
+	From mail.Address
+	// ReplyTo defaults to the configured reply-to and then From.
+	ReplyTo mail.Address
+	To      []mail.Address
+	CC      []mail.Address
+	// Inbox is whether the email is sent to an inbox of the team rather
+	// than to the user of the request, such that the template requires
+	// configured recipients.
+	Inbox bool
+	// Data is the zero value of the data type of the template, for
+	// example &ForgotPasswordData{}.
+	Data interface{}
+	// Sample returns example data of the type of Data for the brand to
+	// preview the template. The zero value of the type is used when it is
+	// not set.
+	Sample func(b config.Brand) interface{}
+}
+
+// registry is the registered templates by name.
+var registry = make(map[string]*Template)
+
+// Register registers the template t. Registering a template without a
+// name, without data or twice is a programming error and panics.
+func Register(t *Template) {
+	if t.Name == "" || t.Data == nil {
+		panic("includes: template requires a name and data")
+	}
+	if _, ok := registry[t.Name]; ok {
+		panic(fmt.Sprintf("includes: template %s registered twice", t.Name))
+	}
+	registry[t.Name] = t
+}
+
+// Lookup returns the registered template by name.
+func Lookup(name string) (*Template, bool) {
+	t, ok := registry[name]
+	return t, ok
+}
+
+// Templates returns the sorted names of the registered templates.
+func Templates() []string {
+	xs := make([]string, 0, len(registry))
+	for name := range registry {
+		xs = append(xs, name)
+	}
+	sort.Strings(xs)
+	return xs
+}
+
+// Msg is an email of a registered Template with the data of type T.
+type Msg[T any] struct {
+	Template *Template
+	Message  *emailserv.Message
+	Data     T
+	// Locale is the locale of the templates used to render the email.
+	Locale string
+	// HTML and Text are the rendered parts of the email.
+	HTML string
+	Text string
+}
+
+// NewMsg creates the email of the registered template name in the locale
+// with the data. The locale is resolved with ResolveLocale. The message
+// has the subject, sender and recipients of the template, the recipients
+// which depend on the request are added to msg.Message.
+func NewMsg[T any](name, locale string, data T) (*Msg[T], dutil.Error) {
+	t, ok := Lookup(name)
+	if !ok {
+		e := dutil.NewErr(500, "template", []string{fmt.Sprintf("template %s not registered", name)})
+		return nil, e
+	}
+	if reflect.TypeOf(data) != reflect.TypeOf(t.Data) {
+		e := dutil.NewErr(500, "template", []string{
+			fmt.Sprintf("template %s requires data %T got %T", name, t.Data, data),
+		})
+		return nil, e
+	}
+
+	locale = ResolveLocale(locale)
+	h := header(t, locale)
+	msg := &Msg[T]{
+		Template: t,
+		Message: &emailserv.Message{
+			Headers: map[string][]string{
+				"Mime-Version": {"1.0"},
+			},
+			From:    h.From,
+			To:      append([]mail.Address{}, h.To...),
+			CC:      append([]mail.Address{}, h.CC...),
+			ReplyTo: h.ReplyTo,
+			Subject: h.Subject,
+		},
+		Data:   data,
+		Locale: locale,
+	}
+	return msg, nil
+}
+
+// header returns the subject, sender and recipients of the template t in
+// the locale, where the configuration of the template replaces those of
+// the template and the configured sender and reply-to are the defaults.
+// The subject is the first of the configured subject of the locale, the
+// configured subject, the template's subject of the locale and the
+// template's subject, so that a configured subject replaces the built-in
+// translations.
+func header(t *Template, locale string) config.EmailTemplate {
+	c := conf.Email.Templates[t.Name]
+	h := config.EmailTemplate{
+		From:    firstAddress(c.From, t.From, conf.Email.From),
+		To:      t.To,
+		CC:      t.CC,
+		Subject: t.Subject,
+	}
+	h.ReplyTo = firstAddress(c.ReplyTo, t.ReplyTo, conf.Email.ReplyTo, h.From)
+	if len(c.To) > 0 {
+		h.To = c.To
+	}
+	if len(c.CC) > 0 {
+		h.CC = c.CC
+	}
+	if s, ok := c.Subjects[locale]; ok {
+		h.Subject = s
+	} else if c.Subject != "" {
+		h.Subject = c.Subject
+	} else if s, ok := t.Subjects[locale]; ok {
+		h.Subject = s
+	}
+	return h
+}
+
+// firstAddress returns the first of the addresses which is set.
+func firstAddress(addrs ...mail.Address) mail.Address {
+	for _, a := range addrs {
+		if a.Address != "" {
+			return a
+		}
+	}
+	return mail.Address{}
+}
+
+// checkTemplates reports the configured templates which are not registered
+// and the registered templates without a sender or, if the template is
+// sent to an inbox, without recipients.
+func checkTemplates(c *config.Config) error {
+	problems := make([]string, 0)
+	for _, name := range sortedKeys(c.Email.Templates) {
+		if _, ok := registry[name]; !ok {
+			problems = append(problems, fmt.Sprintf("email template %s is configured but not registered", name))
+		}
+	}
+	for _, name := range Templates() {
+		t := registry[name]
+		ct := c.Email.Templates[name]
+		if firstAddress(ct.From, t.From, c.Email.From).Address == "" {
+			problems = append(problems, fmt.Sprintf("email template %s has no sender", name))
+		}
+		if t.Inbox && len(ct.To) == 0 && len(t.To) == 0 {
+			problems = append(problems, fmt.Sprintf("email template %s has no recipients", name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	xs := make([]string, 0, len(m))
+	for k := range m {
+		xs = append(xs, k)
+	}
+	sort.Strings(xs)
+	return xs
+}
+
+// mustNewMsg is NewMsg for the templates registered by the includes
+// package, for which an error is a programming error.
+func mustNewMsg[T any](name, locale string, data T) *Msg[T] {
+	msg, e := NewMsg(name, locale, data)
+	if e != nil {
+		panic(e.Error())
+	}
+	return msg
+}
+
+// ExecuteTemplate renders the HTML and plain-text parts of the template
+// with the data as the multipart/alternative emailserv.Message body.
+func (msg *Msg[T]) ExecuteTemplate() dutil.Error {
+	html, text, e := render(msg.Template.Name, msg.Locale, msg.Data)
+	if e != nil {
+		return e
+	}
+	body, boundary, err := alternative(text, html)
+	if err != nil {
+		e := dutil.NewErr(500, "template", []string{"unable to create multipart body", err.Error()})
+		return e
+	}
+	msg.HTML = html
+	msg.Text = text
+	msg.Message.Headers["Content-Type"] = []string{"multipart/alternative", fmt.Sprintf("boundary=%q", boundary)}
+	msg.Message.Body = body
+	return nil
+}
+
+// SendMail sends the email. The suppressed addresses are removed from the
+// recipients first. If there is a queue the email is validated and queued
+// for delivery, otherwise it is delivered immediately.
+func (msg *Msg[T]) SendMail() dutil.Error {
+	e := msg.suppress()
+	if e != nil {
+		return e
+	}
+	if queue == nil {
+		return Deliver(msg.Message)
+	}
+	errs := msg.Message.Validate()
+	if len(errs) > 0 {
+		e := &dutil.Err{
+			Status: 400,
+			Errors: errs,
+		}
+		return e
+	}
+	err := queue.Enqueue(msg.Message)
+	if err != nil {
+		e := dutil.NewErr(500, "outbox", []string{"unable to queue email", err.Error()})
+		return e
+	}
+	return nil
+}
+
+// suppress removes the suppressed addresses from the To and CC recipients
+// of the email. An error is returned if every To recipient is suppressed.
+// If the suppressions are unavailable the email is sent to every address.
+func (msg *Msg[T]) suppress() dutil.Error {
+	if suppressions == nil || len(msg.Message.To) == 0 {
+		return nil
+	}
+	msg.Message.To = unsuppressed(msg.Message.To)
+	msg.Message.CC = unsuppressed(msg.Message.CC)
+	if len(msg.Message.To) == 0 {
+		e := dutil.NewErr(422, "email", []string{"recipient address is suppressed"})
+		return e
+	}
+	return nil
+}
+
+// unsuppressed returns the addresses of xa which are not suppressed.
+func unsuppressed(xa []mail.Address) []mail.Address {
+	xs := make([]mail.Address, 0, len(xa))
+	for _, a := range xa {
+		s, err := suppressions.Get(context.Background(), a.Address)
+		if err == nil {
+			log.Printf("email: not sending to %s which is suppressed after a %s", MaskEmail(a.Address), s.Reason)
+			continue
+		}
+		if err != suppression.ErrNotFound {
+			log.Printf("email: unable to check the suppression of %s: %v", MaskEmail(a.Address), err)
+		}
+		xs = append(xs, a)
+	}
+	return xs
+}
+
+// Deliver sends the email via the emailserv microservice package to the
+// email microservice.
+func Deliver(m *emailserv.Message) dutil.Error {
+	// no token required for the email microservice at the moment (2022-04-17)
+	ms := emailserv.NewService("")
+	return ms.SendMail(m)
+}
+
+// templates are the HTML email templates and textTemplates the plain-text
+// email templates by locale, parsed once by Configure.
+var (
+	templates     map[string]*template.Template
+	textTemplates map[string]*texttemplate.Template
+)
+
+// loadTemplates parses the HTML and plain-text email templates of every
+// locale, each locale is a directory in the templates directory of the
+// working directory. The default locale requires templates.
+func loadTemplates(wd, defaultLocale string) (map[string]*template.Template, map[string]*texttemplate.Template, error) {
+	dir := path.Join(wd, "templates")
+	xd, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	tpls := make(map[string]*template.Template)
+	txts := make(map[string]*texttemplate.Template)
+	for _, d := range xd {
+		if !d.IsDir() {
+			continue
+		}
+		locale := normalizeLocale(d.Name())
+		xs, err := filepath.Glob(path.Join(dir, d.Name(), "*.html"))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(xs) == 0 {
+			continue
+		}
+		tpls[locale], err = template.New("").ParseFiles(xs...)
+		if err != nil {
+			return nil, nil, err
+		}
+		txts[locale] = texttemplate.New("")
+		xs, err = filepath.Glob(path.Join(dir, d.Name(), "*.txt"))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(xs) > 0 {
+			txts[locale], err = txts[locale].ParseFiles(xs...)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if _, ok := tpls[defaultLocale]; !ok {
+		return nil, nil, fmt.Errorf("no templates for the default locale %s in %s", defaultLocale, dir)
+	}
+	return tpls, txts, nil
+}
+
+// render executes the template name of the locale with the data into
+// buffers and returns the rendered HTML and plain text. The template of
+// the default locale is used if the locale has no such template. The plain
+// text is generated from the HTML when the template has no plain-text
+// template. If an archive directory is configured a copy of both is
+// written to the archive.
+func render(name, locale string, data interface{}) (string, string, dutil.Error) {
+	if templates == nil || textTemplates == nil {
+		e := dutil.NewErr(500, "template", []string{"templates not loaded"})
+		return "", "", e
+	}
+	tpl, ok := templates[locale]
+	if !ok || tpl.Lookup(name+".html") == nil {
+		locale = conf.DefaultLocale
+		tpl = templates[locale]
+	}
+	buf := &bytes.Buffer{}
+	err := tpl.ExecuteTemplate(buf, name+".html", data)
+	if err != nil {
+		e := dutil.NewErr(500, "template", []string{"unable to execute template", err.Error()})
+		return "", "", e
+	}
+	html := buf.String()
+
+	text := ""
+	if txt := textTemplates[locale]; txt.Lookup(name+".txt") != nil {
+		buf.Reset()
+		err = txt.ExecuteTemplate(buf, name+".txt", data)
+		if err != nil {
+			e := dutil.NewErr(500, "template", []string{"unable to execute text template", err.Error()})
+			return "", "", e
+		}
+		text = buf.String()
+	} else {
+		text = htmlText(html)
+	}
+
+	if conf.EmailArchiveDir != "" {
+		archive(name, html, text)
+	}
+	return html, text, nil
+}
+
+// alternative creates the multipart/alternative body of the plain-text
+// and HTML parts, the preferred HTML part is last. The parts are
+// quoted-printable encoded to keep the lines of the email short.
+func alternative(text, html string) (string, string, error) {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain; charset=UTF-8", body: text},
+		{contentType: "text/html; charset=UTF-8", body: html},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", "", err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		_, err = qw.Write([]byte(p.body))
+		if err != nil {
+			return "", "", err
+		}
+		err = qw.Close()
+		if err != nil {
+			return "", "", err
+		}
+	}
+	err := mw.Close()
+	if err != nil {
+		return "", "", err
+	}
+	return buf.String(), mw.Boundary(), nil
+}
+
+// archive writes a copy of the rendered HTML and plain text to the archive
+// directory. Archiving is best-effort, failing to archive does not fail
+// the email.
+func archive(name, html, text string) {
+	u, err := uuid.NewUUID()
+	if err != nil {
+		log.Printf("email archive: unable to generate uuid: %v", err)
+		return
+	}
+	files := map[string]string{
+		fmt.Sprintf("%s-%s.html", name, u.String()): html,
+		fmt.Sprintf("%s-%s.txt", name, u.String()):  text,
+	}
+	for file, content := range files {
+		err = os.WriteFile(path.Join(conf.EmailArchiveDir, file), []byte(content), 0644)
+		if err != nil {
+			log.Printf("email archive: unable to write %s: %v", file, err)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package includes
+
+import (
+	"context"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/emailserv"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	"html/template"
+	"io"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+)
+
+func TestRegister(t *testing.T) {
+	defer delete(registry, "welcome")
+	type WelcomeData struct {
+		Name string
+	}
+	Register(&Template{Name: "welcome", Subject: "Welcome", Data: &WelcomeData{}})
+
+	tpl, ok := Lookup("welcome")
+	if !ok || tpl.Subject != "Welcome" {
+		t.Errorf("expected template welcome to be registered got %v", tpl)
+	}
+	xs := Templates()
+	if strings.Join(xs, ",") != "contact-us,contact-us-acknowledgement,forgot-password,password-changed,password-reset-revoked,verify-email,welcome" {
+		t.Errorf("expected templates %v got %v", []string{"contact-us", "contact-us-acknowledgement", "forgot-password", "password-changed", "password-reset-revoked", "verify-email", "welcome"}, xs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a template twice to panic")
+		}
+	}()
+	Register(&Template{Name: "welcome", Data: &WelcomeData{}})
+}
+
+func TestNewMsg(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	msg, e := NewMsg("contact-us", "en", &ContactUsData{Name: "James Bond"})
+	if e != nil {
+		t.Fatalf("expected error %v got %v", nil, e)
+	}
+	tpl, _ := Lookup("contact-us")
+	if msg.Template != tpl {
+		t.Errorf("expected template %v got %v", tpl, msg.Template)
+	}
+	if msg.Message.Subject != tpl.Subject {
+		t.Errorf("expected subject '%s' got '%s'", tpl.Subject, msg.Message.Subject)
+	}
+	if msg.Message.From != testEmail.From || msg.Message.ReplyTo != testEmail.From {
+		t.Errorf("expected from and reply-to %v got %v and %v", testEmail.From, msg.Message.From, msg.Message.ReplyTo)
+	}
+	// the recipients of the message must not modify the configuration
+	to := testEmail.Templates["contact-us"].To
+	msg.Message.To = append(msg.Message.To, mail.Address{Address: "james@bond.com"})
+	msg.Message.To[0].Name = "changed"
+	if len(to) != 1 || to[0].Name == "changed" {
+		t.Errorf("expected the configured recipients to be unchanged got %v", to)
+	}
+	if msg.Data.Name != "James Bond" {
+		t.Errorf("expected data name '%s' got '%s'", "James Bond", msg.Data.Name)
+	}
+
+	_, e = NewMsg("does-not-exist", "en", &ContactUsData{})
+	if e == nil || dutil.Inst(e).Status != 500 {
+		t.Errorf("expected a 500 error for an unregistered template got %v", e)
+	}
+	_, e = NewMsg("contact-us", "en", &ForgotPasswordData{})
+	if e == nil || dutil.Inst(e).Status != 500 {
+		t.Errorf("expected a 500 error for the wrong data type got %v", e)
+	}
+}
+
+func TestNewMsg_Header(t *testing.T) {
+	defer func(c *config.Config) { conf = c }(conf)
+	defer delete(registry, "welcome")
+	type WelcomeData struct{}
+	Register(&Template{
+		Name:     "welcome",
+		Subject:  "Welcome",
+		Subjects: map[string]string{"de": "Willkommen"},
+		ReplyTo:  mail.Address{Address: "welcome@dottics.com"},
+		CC:       []mail.Address{{Address: "cc@dottics.com"}},
+		Data:     &WelcomeData{},
+	})
+
+	type E struct {
+		from    string
+		replyTo string
+		to      string
+		cc      string
+		subject string
+	}
+	tests := []struct {
+		name   string
+		locale string
+		email  config.Email
+		E      E
+	}{
+		{
+			name:   "template and configured defaults",
+			locale: "en",
+			email: config.Email{
+				From:    mail.Address{Address: "mail@dottics.com"},
+				ReplyTo: mail.Address{Address: "howzit@dottics.com"},
+			},
+			E: E{
+				from:    "mail@dottics.com",
+				replyTo: "welcome@dottics.com",
+				to:      "[]",
+				cc:      "[cc@dottics.com]",
+				subject: "Welcome",
+			},
+		},
+		{
+			name:   "configured template",
+			locale: "de",
+			email: config.Email{
+				From: mail.Address{Address: "mail@dottics.com"},
+				Templates: map[string]config.EmailTemplate{
+					"welcome": {
+						From:     mail.Address{Address: "staging@dottics.com"},
+						ReplyTo:  mail.Address{Address: "support@dottics.com"},
+						To:       []mail.Address{{Address: "team@dottics.com"}},
+						CC:       []mail.Address{{Address: "qa@dottics.com"}},
+						Subject:  "[staging] Welcome",
+						Subjects: map[string]string{"de": "[staging] Willkommen"},
+					},
+				},
+			},
+			E: E{
+				from:    "staging@dottics.com",
+				replyTo: "support@dottics.com",
+				to:      "[team@dottics.com]",
+				cc:      "[qa@dottics.com]",
+				subject: "[staging] Willkommen",
+			},
+		},
+		{
+			name:   "configured subject of the default locale",
+			locale: "af",
+			email: config.Email{
+				From: mail.Address{Address: "mail@dottics.com"},
+				Templates: map[string]config.EmailTemplate{
+					"welcome": {Subject: "[staging] Welcome"},
+				},
+			},
+			E: E{
+				from:    "mail@dottics.com",
+				replyTo: "welcome@dottics.com",
+				to:      "[]",
+				cc:      "[cc@dottics.com]",
+				subject: "[staging] Welcome",
+			},
+		},
+		{
+			name:   "configured subject of a built-in locale",
+			locale: "de",
+			email: config.Email{
+				From: mail.Address{Address: "mail@dottics.com"},
+				Templates: map[string]config.EmailTemplate{
+					"welcome": {Subject: "[staging] Welcome"},
+				},
+			},
+			E: E{
+				from:    "mail@dottics.com",
+				replyTo: "welcome@dottics.com",
+				to:      "[]",
+				cc:      "[cc@dottics.com]",
+				subject: "[staging] Welcome",
+			},
+		},
+		{
+			name:   "template subject of a built-in locale",
+			locale: "de",
+			email: config.Email{
+				From: mail.Address{Address: "mail@dottics.com"},
+			},
+			E: E{
+				from:    "mail@dottics.com",
+				replyTo: "welcome@dottics.com",
+				to:      "[]",
+				cc:      "[cc@dottics.com]",
+				subject: "Willkommen",
+			},
+		},
+	}
+
+	addresses := func(xa []mail.Address) string {
+		xs := make([]string, len(xa))
+		for i, a := range xa {
+			xs[i] = a.Address
+		}
+		return fmt.Sprint(xs)
+	}
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			conf = &config.Config{DefaultLocale: "en", Email: tc.email}
+			h := header(registry["welcome"], tc.locale)
+			if h.From.Address != tc.E.from || h.ReplyTo.Address != tc.E.replyTo {
+				t.Errorf("expected from %s and reply-to %s got %v and %v", tc.E.from, tc.E.replyTo, h.From, h.ReplyTo)
+			}
+			if addresses(h.To) != tc.E.to || addresses(h.CC) != tc.E.cc {
+				t.Errorf("expected to %s and cc %s got %v and %v", tc.E.to, tc.E.cc, h.To, h.CC)
+			}
+			if h.Subject != tc.E.subject {
+				t.Errorf("expected subject %q got %q", tc.E.subject, h.Subject)
+			}
+		})
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	tests := []struct {
+		name  string
+		email config.Email
+		err   string
+	}{
+		{
+			name:  "valid",
+			email: testEmail,
+		},
+		{
+			name: "no sender or recipients",
+			err:  "email template contact-us has no sender, email template contact-us has no recipients, email template contact-us-acknowledgement has no sender, email template forgot-password has no sender, email template password-changed has no sender, email template password-reset-revoked has no sender, email template verify-email has no sender",
+		},
+		{
+			name: "configured template not registered",
+			email: config.Email{
+				From: mail.Address{Address: "mail@dottics.com"},
+				Templates: map[string]config.EmailTemplate{
+					"contact-us":  {To: []mail.Address{{Address: "howzit@dottics.com"}}},
+					"contact_us2": {To: []mail.Address{{Address: "howzit@dottics.com"}}},
+				},
+			},
+			err: "email template contact_us2 is configured but not registered",
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			err := checkTemplates(&config.Config{Email: tc.email})
+			if fmt.Sprint(err) != tc.err && !(err == nil && tc.err == "") {
+				t.Errorf("expected error %q got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestNewMsg_Locale(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	tests := []struct {
+		locale  string
+		Elocale string
+		subject string
+	}{
+		{locale: "", Elocale: "en", subject: "Dottics Contact Us"},
+		{locale: "de-CH", Elocale: "de", subject: "Dottics Kontakt"},
+		{locale: "af", Elocale: "af", subject: "Dottics Kontak Ons"},
+		{locale: "fr", Elocale: "en", subject: "Dottics Contact Us"},
+	}
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d %s", i, tc.locale), func(t *testing.T) {
+			msg, e := NewMsg("contact-us", tc.locale, &ContactUsData{Name: "James Bond", Message: "hallo"})
+			if e != nil {
+				t.Fatalf("expected error %v got %v", nil, e)
+			}
+			if msg.Locale != tc.Elocale {
+				t.Errorf("expected locale '%s' got '%s'", tc.Elocale, msg.Locale)
+			}
+			if msg.Message.Subject != tc.subject {
+				t.Errorf("expected subject '%s' got '%s'", tc.subject, msg.Message.Subject)
+			}
+			e = msg.ExecuteTemplate()
+			if e != nil {
+				t.Fatalf("expected error %v got %v", nil, e)
+			}
+			lang := fmt.Sprintf(`<html lang="%s">`, tc.Elocale)
+			if !strings.Contains(msg.HTML, lang) {
+				t.Errorf("expected the %s template", tc.Elocale)
+			}
+		})
+	}
+}
+
+func TestRender_DefaultLocale(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	defer Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	// a locale without the template uses the template of the default locale
+	templates["af"] = template.Must(template.New("").Parse(`{{define "other.html"}}ander{{end}}`))
+	html, _, e := render("contact-us", "af", &ContactUsData{Message: "hello"})
+	if e != nil {
+		t.Fatalf("expected error %v got %v", nil, e)
+	}
+	if !strings.Contains(html, `<html lang="en">`) {
+		t.Errorf("expected the en template")
+	}
+}
+
+func TestRender(t *testing.T) {
+	wd, _ := os.Getwd()
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	_, _, e := render("does-not-exist", "en", nil)
+	if e == nil || dutil.Inst(e).Status != 500 {
+		t.Errorf("expected a 500 error for an unknown template got %v", e)
+	}
+
+	data := &ContactUsData{Name: "James Bond", Message: "shaken,\nnot stirred"}
+	html, text, e := render("contact-us", "en", data)
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if !strings.Contains(html, data.Message) || !strings.Contains(html, "<html") {
+		t.Errorf("expected html to contain %s", data.Message)
+	}
+	if !strings.Contains(text, "Message\n"+data.Message) {
+		t.Errorf("expected the plain-text template to contain %s got %s", data.Message, text)
+	}
+
+	// a template without a plain-text template has the text generated
+	textTemplates["en"] = texttemplate.New("")
+	defer Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	_, text, e = render("contact-us", "en", data)
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if !strings.Contains(text, "Message\n\nshaken, not stirred") || strings.Contains(text, "<") {
+		t.Errorf("expected generated plain text got %s", text)
+	}
+
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+	fp := &ForgotPasswordData{ResetPasswordLink: "https://test.dottics.com/reset-password?r=1"}
+	_, text, e = render("forgot-password", "en", fp)
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if !strings.HasPrefix(text, "Forgot password\n") || !strings.Contains(text, fp.ResetPasswordLink+"\n") {
+		t.Errorf("expected the plain-text template got %s", text)
+	}
+}
+
+func TestRender_Archive(t *testing.T) {
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail, EmailArchiveDir: dir})
+	defer Configure(&config.Config{WorkDir: path.Join(wd, "../.."), DefaultLocale: "en", Email: testEmail})
+
+	data := &ContactUsData{Name: "James Bond", Message: "shaken, not stirred"}
+	html, text, e := render("contact-us", "en", data)
+	if e != nil {
+		t.Fatalf("expected error %v got %v", nil, e)
+	}
+	xs, _ := os.ReadDir(dir)
+	if len(xs) != 2 {
+		t.Fatalf("expected %d archived files got %d", 2, len(xs))
+	}
+	parts := map[string]string{".html": html, ".txt": text}
+	for _, x := range xs {
+		if !strings.HasPrefix(x.Name(), "contact-us-") {
+			t.Errorf("expected archive contact-us-<uuid>%s got %s", path.Ext(x.Name()), x.Name())
+		}
+		xb, _ := os.ReadFile(path.Join(dir, x.Name()))
+		if string(xb) != parts[path.Ext(x.Name())] {
+			t.Errorf("expected the archive %s to contain the rendered part", x.Name())
+		}
+	}
+}
+
+func TestAlternative(t *testing.T) {
+	text := "reset password (https://test.dottics.com/reset-password?r=1)\n"
+	html := "<html><body>" + strings.Repeat("<p>a long line</p>", 100) + "</body></html>"
+	body, boundary, err := alternative(text, html)
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	for _, ln := range strings.Split(body, "\r\n") {
+		if len(ln) > 78 {
+			t.Errorf("expected lines of at most %d characters got %d", 78, len(ln))
+		}
+	}
+
+	mr := multipart.NewReader(strings.NewReader(body), boundary)
+	E := []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain; charset=UTF-8", body: text},
+		{contentType: "text/html; charset=UTF-8", body: html},
+	}
+	for i, ep := range E {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("expected part %d got %v", i, err)
+		}
+		if p.Header.Get("Content-Type") != ep.contentType {
+			t.Errorf("expected content type '%s' got '%s'", ep.contentType, p.Header.Get("Content-Type"))
+		}
+		xb, _ := io.ReadAll(p)
+		// line breaks are CRLF in the email
+		if strings.ReplaceAll(string(xb), "\r\n", "\n") != ep.body {
+			t.Errorf("expected part body %q got %q", ep.body, string(xb))
+		}
+	}
+	_, err = mr.NextPart()
+	if err != io.EOF {
+		t.Errorf("expected %d parts", len(E))
+	}
+}
+
+// queueFunc is a Queue of a function.
+type queueFunc func(m *emailserv.Message) error
+
+func (f queueFunc) Enqueue(m *emailserv.Message) error {
+	return f(m)
+}
+
+func TestMsg_SendMail_Queue(t *testing.T) {
+	defer UseQueue(nil)
+	queued := make([]*emailserv.Message, 0)
+	UseQueue(queueFunc(func(m *emailserv.Message) error {
+		queued = append(queued, m)
+		return nil
+	}))
+
+	msg, _ := NewMsg("contact-us", "en", &ContactUsData{Name: "James Bond"})
+	e := msg.SendMail()
+	if !dutil.ErrorEqual(e, &dutil.Err{Status: 400, Errors: map[string][]string{"body": {"required"}}}) {
+		t.Errorf("expected the invalid email to be rejected got %v", e)
+	}
+	if len(queued) != 0 {
+		t.Errorf("expected the invalid email not to be queued")
+	}
+
+	msg.Message.Body = "body"
+	e = msg.SendMail()
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if len(queued) != 1 || queued[0] != msg.Message {
+		t.Errorf("expected the email to be queued got %v", queued)
+	}
+
+	UseQueue(queueFunc(func(m *emailserv.Message) error {
+		return fmt.Errorf("disk full")
+	}))
+	e = msg.SendMail()
+	if e == nil || dutil.Inst(e).Status != 500 {
+		t.Errorf("expected a 500 error when the email cannot be queued got %v", e)
+	}
+}
+
+func TestMsg_SendMail_Suppressed(t *testing.T) {
+	defer UseQueue(nil)
+	defer UseSuppressions(nil)
+	queued := make([]*emailserv.Message, 0)
+	UseQueue(queueFunc(func(m *emailserv.Message) error {
+		queued = append(queued, m)
+		return nil
+	}))
+	store := suppression.NewMemory()
+	_ = store.Add(context.Background(), suppression.Suppression{Address: "james@bond.com", Reason: suppression.ReasonBounce})
+	UseSuppressions(store)
+
+	msg, _ := NewMsg("contact-us", "en", &ContactUsData{Name: "James Bond"})
+	msg.Message.Body = "body"
+	msg.Message.To = []mail.Address{{Address: "James@Bond.com"}, {Address: "q@mi6.com"}}
+	msg.Message.CC = []mail.Address{{Address: "james@bond.com"}}
+	e := msg.SendMail()
+	if e != nil {
+		t.Errorf("expected error %v got %v", nil, e)
+	}
+	if len(msg.Message.To) != 1 || msg.Message.To[0].Address != "q@mi6.com" || len(msg.Message.CC) != 0 {
+		t.Errorf("expected the suppressed address to be removed got to %v cc %v", msg.Message.To, msg.Message.CC)
+	}
+
+	msg.Message.To = []mail.Address{{Address: "james@bond.com"}}
+	e = msg.SendMail()
+	if !dutil.ErrorEqual(e, dutil.NewErr(422, "email", []string{"recipient address is suppressed"})) {
+		t.Errorf("expected a suppressed recipient error got %v", e)
+	}
+	if len(queued) != 1 {
+		t.Errorf("expected %d queued email got %d", 1, len(queued))
+	}
+}
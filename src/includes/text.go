@@ -0,0 +1,135 @@
+package includes
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// skipElements are the elements of which the content is not text.
+var skipElements = map[string]bool{
+	"head":   true,
+	"title":  true,
+	"style":  true,
+	"script": true,
+	"svg":    true,
+}
+
+// blockElements are the elements which start on a new line.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "br": true,
+	"div": true, "footer": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"li": true, "main": true, "ol": true, "p": true, "section": true,
+	"table": true, "tr": true, "ul": true,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// htmlText generates the plain-text version of an HTML email. Block
+// elements start on a new line, paragraphs are separated by a blank line
+// and links are written as "text (href)".
+func htmlText(s string) string {
+	b := &strings.Builder{}
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+	hrefs := make([]string, 0)
+	link := &strings.Builder{}
+	// space is whether whitespace separates the previous text and the next
+	space := false
+	// newlines ensures the text ends with at least n newlines
+	newlines := func(n int) {
+		if b.Len() == 0 {
+			return
+		}
+		for i := len(b.String()) - 1; i >= 0 && b.String()[i] == '\n'; i-- {
+			n--
+		}
+		if n > 0 {
+			b.WriteString(strings.Repeat("\n", n))
+		}
+		space = false
+	}
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return tidyText(b.String())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if skipElements[tag] {
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			if tag == "a" {
+				if tt == html.StartTagToken {
+					href := ""
+					for hasAttr {
+						var key, value []byte
+						key, value, hasAttr = z.TagAttr()
+						if string(key) == "href" {
+							href = string(value)
+						}
+					}
+					hrefs = append(hrefs, href)
+					link.Reset()
+				} else if tt == html.EndTagToken && len(hrefs) > 0 {
+					href := hrefs[len(hrefs)-1]
+					hrefs = hrefs[:len(hrefs)-1]
+					text := strings.TrimSpace(link.String())
+					if href != "" && href != text {
+						if text != "" {
+							b.WriteString(" ")
+						}
+						b.WriteString("(" + href + ")")
+						space = false
+					}
+				}
+				continue
+			}
+			if tag == "p" || len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+				newlines(2)
+			} else if blockElements[tag] {
+				newlines(1)
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			raw := string(z.Text())
+			text := strings.Join(strings.Fields(raw), " ")
+			if text == "" {
+				space = space || raw != ""
+				continue
+			}
+			if (space || strings.TrimLeft(raw, " \t\r\n") != raw) && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString(" ")
+			}
+			b.WriteString(text)
+			space = strings.TrimRight(raw, " \t\r\n") != raw
+			if len(hrefs) > 0 {
+				link.WriteString(" " + text)
+			}
+		}
+	}
+}
+
+// tidyText trims every line and collapses consecutive blank lines.
+func tidyText(s string) string {
+	xs := strings.Split(s, "\n")
+	for i, x := range xs {
+		xs[i] = strings.TrimSpace(x)
+	}
+	s = strings.Join(xs, "\n")
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s) + "\n"
+}
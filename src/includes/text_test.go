@@ -0,0 +1,57 @@
+package includes
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHtmlText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		text string
+	}{
+		{
+			name: "paragraphs",
+			html: `<html><body><p>first paragraph</p><p>second
+				paragraph</p></body></html>`,
+			text: "first paragraph\n\nsecond paragraph\n",
+		},
+		{
+			name: "head, style and svg are skipped",
+			html: `<html><head><title>email</title><style>p { color: red; }</style></head>` +
+				`<body><div class="logo"><svg><path d="M0"/></svg></div><p>hello</p></body></html>`,
+			text: "hello\n",
+		},
+		{
+			name: "links",
+			html: `<p>Please follow the link</p><a href="https://test.dottics.com/reset-password?r=1">reset password</a>`,
+			text: "Please follow the link\n\nreset password (https://test.dottics.com/reset-password?r=1)\n",
+		},
+		{
+			name: "link text is the href",
+			html: `<a href="https://test.dottics.com">https://test.dottics.com</a>`,
+			text: "https://test.dottics.com\n",
+		},
+		{
+			name: "inline elements",
+			html: `<div>Name <b>James Bond</b></div><div>Email</div>`,
+			text: "Name James Bond\nEmail\n",
+		},
+		{
+			name: "entities are decoded",
+			html: `<p>Tom &amp; Jerry&#39;s &lt;message&gt;</p>`,
+			text: "Tom & Jerry's <message>\n",
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			text := htmlText(tc.html)
+			if text != tc.text {
+				t.Errorf("expected text %q got %q", tc.text, text)
+			}
+		})
+	}
+}
@@ -1,7 +1,100 @@
 package includes
 
+import (
+	security "github.com/dottics/securityserv"
+	"time"
+)
+
 type ContactUsMsgPayload struct {
 	Name    string `json:"name"`
 	Email   string `json:"email"`
 	Message string `json:"message"`
+	// Category is the optional category of the message, which must be one
+	// of the configured categories.
+	Category string `json:"category"`
+	// Reference is the optional reference of the message, such as the ID
+	// of a flight.
+	Reference string `json:"reference"`
+	// Locale is the optional locale of the email, it takes precedence
+	// over the Accept-Language of the request.
+	Locale string `json:"locale"`
+	// Website is the honeypot of the form, a field which is hidden from
+	// users such that only bots fill it out.
+	Website string `json:"website"`
+	// SubmitTimeMS is the milliseconds the user took to fill out the form,
+	// measured by the client.
+	SubmitTimeMS int64 `json:"submit_time_ms"`
+}
+
+// RevokePasswordPayload is the request to revoke the password reset token,
+// the owner of the token is notified in the optional locale.
+type RevokePasswordPayload struct {
+	PasswordResetToken string `json:"password_reset_token"`
+	Locale             string `json:"locale"`
+}
+
+// RegisterPayload is the request to create the account of a new user, the
+// verification email is sent in the optional locale.
+type RegisterPayload struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Locale    string `json:"locale,omitempty"`
+}
+
+// VerifyEmailPayload is the request to verify an email with the token,
+// the expiry and the signature of the link of the verification email.
+type VerifyEmailPayload struct {
+	EmailVerificationToken string `json:"email_verification_token"`
+	Expires                int64  `json:"expires"`
+	Signature              string `json:"signature"`
+}
+
+// ResendVerificationPayload is the request to resend the verification
+// email to the email in the optional locale.
+type ResendVerificationPayload struct {
+	Email  string `json:"email"`
+	Locale string `json:"locale"`
+}
+
+// ChangePasswordPayload is the request of an authenticated user to change
+// the password, the user is notified of the change in the optional locale.
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	Locale          string `json:"locale,omitempty"`
+}
+
+// The statuses of a password reset token.
+const (
+	TokenValid   = "valid"
+	TokenExpired = "expired"
+	TokenUsed    = "used"
+	TokenRevoked = "revoked"
+)
+
+// ResetTokenStatus is the validity of a password reset token. ExpiresIn is
+// the remaining lifetime of a valid token in seconds.
+type ResetTokenStatus struct {
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresIn int64     `json:"expires_in"`
+}
+
+// ForgotPasswordPayload is the request for a password reset token with the
+// optional locale of the forgot password email.
+type ForgotPasswordPayload struct {
+	Email  string `json:"email"`
+	Locale string `json:"locale"`
+}
+
+// Session is an authenticated user's token, the user and the user's
+// permission codes as resolved by the security microservice. The token is
+// never marshalled, so that a cached session does not hold the credentials
+// of the user.
+type Session struct {
+	Token           string                   `json:"-"`
+	User            security.User            `json:"user"`
+	PermissionCodes security.PermissionCodes `json:"permission_codes"`
 }
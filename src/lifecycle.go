@@ -0,0 +1,163 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Go runs the function f in the background. The Server waits for all
+// the background functions to return before it completes its shutdown.
+func (s *Server) Go(f func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		f()
+	}()
+}
+
+// OnShutdown registers a function which is called once the Server has
+// stopped accepting requests and all background functions have returned.
+func (s *Server) OnShutdown(f func(ctx context.Context) error) {
+	s.shutdownHooks = append(s.shutdownHooks, f)
+}
+
+// OnServe registers a function which runs in the background while the
+// Server serves requests. The context of f is done once the Server has
+// stopped accepting requests and the Server waits for f to return.
+func (s *Server) OnServe(f func(ctx context.Context)) {
+	s.serveHooks = append(s.serveHooks, f)
+}
+
+// ListenAndServe listens on the TCP address addr and serves requests
+// until the context is done, then shuts the Server down gracefully.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves requests on the listener ln until the context is done.
+// The Server then reports not ready for the drain period, stops accepting
+// connections, waits for in-flight requests, stops the serve hooks, waits
+// for background work and finally calls the shutdown hooks.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Router,
+		ReadTimeout:       s.Config.Timeouts.Read,
+		ReadHeaderTimeout: s.Config.Timeouts.ReadHeader,
+		WriteTimeout:      s.Config.Timeouts.Write,
+		IdleTimeout:       s.Config.Timeouts.Idle,
+	}
+
+	hookCtx, stopHooks := context.WithCancel(context.Background())
+	defer stopHooks()
+	for _, f := range s.serveHooks {
+		f := f
+		s.Go(func() {
+			f(hookCtx)
+		})
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+	s.ready.Store(true)
+
+	select {
+	case err := <-serveErr:
+		s.ready.Store(false)
+		stopHooks()
+		s.background.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down: draining for %s\n", s.Config.Timeouts.Drain)
+	s.ready.Store(false)
+	time.Sleep(s.Config.Timeouts.Drain)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.Config.Timeouts.Shutdown)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Println("shutdown:", err)
+	}
+	stopHooks()
+
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Println("shutdown: background work did not complete in time")
+	}
+
+	for _, f := range s.shutdownHooks {
+		hookErr := f(shutdownCtx)
+		if hookErr != nil {
+			log.Println("shutdown hook:", hookErr)
+		}
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Println("shutdown complete")
+	return nil
+}
+
+// readiness reports whether the Server is ready to receive requests. The
+// Server is not ready before it is serving, while it is shutting down and
+// while any critical dependency is unhealthy. The status and latency of
+// each dependency are served, the reason a dependency is unhealthy is
+// logged.
+func (s *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		e := dutil.NewErr(503, "ready", []string{"server is not ready"})
+		handler.Error(w, r, e)
+		return
+	}
+
+	xr := s.probe(r.Context())
+	errs := dutil.Errors{}
+	for _, pr := range xr {
+		if pr.Healthy {
+			continue
+		}
+		log.Printf("readiness: %s unhealthy after %.1f ms: %s\n", pr.Name, pr.LatencyMS, pr.Error)
+		if pr.Critical {
+			errs[pr.Name] = []string{"unhealthy"}
+		}
+	}
+	data := struct {
+		Ready        bool          `json:"ready"`
+		Dependencies []ProbeResult `json:"dependencies"`
+	}{
+		Ready:        len(errs) == 0,
+		Dependencies: xr,
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "ready",
+		Data:    data,
+	}
+	if len(errs) > 0 {
+		resp.Status = 503
+		resp.Message = http.StatusText(503)
+		resp.Errors = errs
+	}
+	resp.Respond(w, r)
+}
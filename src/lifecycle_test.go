@@ -0,0 +1,103 @@
+package src
+
+import (
+	"context"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServer_Serve(t *testing.T) {
+	s := &Server{
+		Router: mux.NewRouter(),
+		CORS:   &CORS{AllowedOrigins: []string{"*"}},
+		Config: &config.Config{
+			Timeouts: config.Timeouts{
+				Drain:    200 * time.Millisecond,
+				Shutdown: 5 * time.Second,
+			},
+		},
+	}
+	s.Router.HandleFunc("/health/ready", s.prop(s.readiness))
+	started := make(chan struct{})
+	s.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(400 * time.Millisecond)
+		w.WriteHeader(200)
+	})
+
+	var background, hook, serving atomic.Bool
+	s.OnServe(func(ctx context.Context) {
+		<-ctx.Done()
+		serving.Store(true)
+	})
+	s.Go(func() {
+		time.Sleep(500 * time.Millisecond)
+		background.Store(true)
+	})
+	s.OnShutdown(func(ctx context.Context) error {
+		if !background.Load() {
+			t.Errorf("expected background work to complete before the shutdown hooks")
+		}
+		hook.Store(true)
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + ln.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(ctx, ln)
+	}()
+
+	res, err := http.Get(url + "/health/ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("expected ready status %d got %d", 200, res.StatusCode)
+	}
+
+	slow := make(chan int, 1)
+	go func() {
+		res, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		slow <- res.StatusCode
+	}()
+	<-started
+	cancel()
+
+	// during the drain period the server still serves but is not ready
+	time.Sleep(50 * time.Millisecond)
+	res, err = http.Get(url + "/health/ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 503 {
+		t.Errorf("expected draining status %d got %d", 503, res.StatusCode)
+	}
+
+	if status := <-slow; status != 200 {
+		t.Errorf("expected in-flight request status %d got %d", 200, status)
+	}
+	if err := <-serveErr; err != nil {
+		t.Errorf("expected error %v got %v", nil, err)
+	}
+	if !hook.Load() {
+		t.Errorf("expected the shutdown hook to be called")
+	}
+	if !serving.Load() {
+		t.Errorf("expected the serve hook to be stopped")
+	}
+}
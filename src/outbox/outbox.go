@@ -0,0 +1,231 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/emailserv"
+	"github.com/google/uuid"
+	"log"
+	"sync"
+	"time"
+)
+
+// Sender delivers an email, such as to the email microservice.
+type Sender func(m *emailserv.Message) dutil.Error
+
+// Options configures the delivery of the Outbox.
+type Options struct {
+	// Workers is the number of emails delivered concurrently.
+	Workers int
+	// MaxAttempts is the number of attempts after which an email is moved
+	// to the dead letters.
+	MaxAttempts int
+	// BackoffBase is the delay after the first failed attempt, the delay
+	// doubles with each attempt up to BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// PollInterval is how often the store is checked for emails which are
+	// due for delivery.
+	PollInterval time.Duration
+}
+
+// Outbox persists emails in the Store and delivers them in the background
+// with a pool of workers. Failed deliveries are retried with exponential
+// backoff and moved to the dead letters after the maximum attempts or if
+// the email is rejected.
+type Outbox struct {
+	Store *Store
+	send  Sender
+	opts  Options
+	now   func() time.Time
+
+	mu       sync.Mutex
+	inflight map[string]bool
+	wake     chan struct{}
+}
+
+// New creates the Outbox for the store which delivers emails with send.
+func New(store *Store, send Sender, opts Options) *Outbox {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	return &Outbox{
+		Store:    store,
+		send:     send,
+		opts:     opts,
+		now:      time.Now,
+		inflight: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Enqueue persists the email for delivery. Once Enqueue returns the email
+// is delivered even if the gateway restarts.
+func (o *Outbox) Enqueue(m *emailserv.Message) error {
+	now := o.now()
+	e := Entry{
+		ID:          uuid.New().String(),
+		Message:     m,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}
+	err := o.Store.Put(e)
+	if err != nil {
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Requeue moves the dead letter with the id back to pending for immediate
+// delivery.
+func (o *Outbox) Requeue(id string) (Entry, error) {
+	e, err := o.Store.Requeue(id, o.now())
+	if err != nil {
+		return e, err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return e, nil
+}
+
+// Run delivers the pending emails until the context is done. The workers
+// complete the delivery they are busy with before Run returns, emails
+// which are still pending are delivered the next time the Outbox runs.
+func (o *Outbox) Run(ctx context.Context) {
+	jobs := make(chan string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < o.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				o.deliver(id)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(o.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		o.dispatch(ctx, jobs)
+		select {
+		case <-ctx.Done():
+			close(jobs)
+			wg.Wait()
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// dispatch sends every pending entry which is due and not already being
+// delivered to the workers.
+func (o *Outbox) dispatch(ctx context.Context, jobs chan<- string) {
+	for _, id := range o.Store.Due(o.now()) {
+		o.mu.Lock()
+		busy := o.inflight[id]
+		o.inflight[id] = true
+		o.mu.Unlock()
+		if busy {
+			continue
+		}
+		select {
+		case jobs <- id:
+		case <-ctx.Done():
+			o.done(id)
+			return
+		}
+	}
+}
+
+func (o *Outbox) done(id string) {
+	o.mu.Lock()
+	delete(o.inflight, id)
+	o.mu.Unlock()
+}
+
+// deliver attempts to deliver the entry with the id. A successful delivery
+// removes the entry, a rejected email or the last failed attempt
+// moves the entry to the dead letters and any other failure is retried
+// later. The entry is read again as it may have been delivered since it
+// was dispatched.
+func (o *Outbox) deliver(id string) {
+	defer o.done(id)
+	e, err := o.Store.Get(id)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Printf("outbox: %s: %v\n", id, err)
+		}
+		return
+	}
+	if e.NextAttempt.After(o.now()) {
+		return
+	}
+	e.Attempts++
+	de := o.attempt(e.Message)
+	if de == nil {
+		err := o.Store.Delete(e.ID)
+		if err != nil {
+			log.Printf("outbox: delivered %s: %v\n", e.ID, err)
+		}
+		return
+	}
+
+	e.LastError = de.Error()
+	if rejected(dutil.Inst(de).Status) || e.Attempts >= o.opts.MaxAttempts {
+		log.Printf("outbox: %s dead after %d attempts: %s\n", e.ID, e.Attempts, e.LastError)
+		err := o.Store.Bury(e)
+		if err != nil {
+			log.Printf("outbox: bury %s: %v\n", e.ID, err)
+		}
+		return
+	}
+	e.NextAttempt = o.now().Add(o.backoff(e.Attempts))
+	err = o.Store.Put(e)
+	if err != nil {
+		log.Printf("outbox: retry %s: %v\n", e.ID, err)
+	}
+}
+
+// attempt sends the message and recovers from a panic of the sender, which
+// the microservice packages may raise when the service is unreachable.
+func (o *Outbox) attempt(m *emailserv.Message) (e dutil.Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e = dutil.NewErr(503, "outbox", []string{fmt.Sprintf("send failed: %v", r)})
+		}
+	}()
+	return o.send(m)
+}
+
+// rejected reports whether the status is a client error which is not
+// resolved by trying again.
+func rejected(status int) bool {
+	return status >= 400 && status < 500 && status != 408 && status != 429
+}
+
+// backoff returns the delay after the n-th failed attempt.
+func (o *Outbox) backoff(n int) time.Duration {
+	d := o.opts.BackoffBase
+	for i := 1; i < n; i++ {
+		d *= 2
+		if d >= o.opts.BackoffMax {
+			return o.opts.BackoffMax
+		}
+	}
+	if d > o.opts.BackoffMax {
+		return o.opts.BackoffMax
+	}
+	return d
+}
@@ -0,0 +1,188 @@
+package outbox
+
+import (
+	"context"
+	"github.com/dottics/dutil"
+	"github.com/dottics/emailserv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sender records the messages and returns the errors in order.
+type sender struct {
+	mu     sync.Mutex
+	sent   []string
+	errors []dutil.Error
+}
+
+func (s *sender) send(m *emailserv.Message) dutil.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, m.Subject)
+	if len(s.errors) == 0 {
+		return nil
+	}
+	e := s.errors[0]
+	s.errors = s.errors[1:]
+	if e == nil {
+		return nil
+	}
+	return e
+}
+
+func newOutbox(t *testing.T, s *sender, max int) *Outbox {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	return New(store, s.send, Options{
+		Workers:      2,
+		MaxAttempts:  max,
+		BackoffBase:  time.Second,
+		BackoffMax:   time.Minute,
+		PollInterval: time.Hour,
+	})
+}
+
+func TestOutbox_deliver(t *testing.T) {
+	start := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	unavailable := dutil.NewErr(503, "email", []string{"unavailable"})
+	rejected := dutil.NewErr(400, "to", []string{"minimum 1 address"})
+
+	tests := []struct {
+		name        string
+		errors      []dutil.Error
+		attempts    int
+		pending     bool
+		dead        bool
+		nextAttempt time.Time
+	}{
+		{name: "delivered", errors: nil, attempts: 1},
+		{name: "retry with backoff", errors: []dutil.Error{unavailable}, attempts: 1, pending: true, nextAttempt: start.Add(time.Second)},
+		// attempts at 0s and 1s, the second backoff is 2s
+		{name: "backoff doubles", errors: []dutil.Error{unavailable, unavailable}, attempts: 2, pending: true, nextAttempt: start.Add(3 * time.Second)},
+		{name: "dead after max attempts", errors: []dutil.Error{unavailable, unavailable, unavailable}, attempts: 3, dead: true},
+		{name: "rejected is dead immediately", errors: []dutil.Error{rejected}, attempts: 1, dead: true},
+		{name: "rate limited is retried", errors: []dutil.Error{dutil.NewErr(429, "email", []string{"slow down"})}, attempts: 1, pending: true, nextAttempt: start.Add(time.Second)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := start
+			s := &sender{errors: tc.errors}
+			o := newOutbox(t, s, 3)
+			o.now = func() time.Time { return now }
+			err := o.Enqueue(&emailserv.Message{Subject: "test"})
+			if err != nil {
+				t.Fatalf("expected error %v got %v", nil, err)
+			}
+			xe, _ := o.Store.Pending()
+			id := xe[0].ID
+			for i := 0; i < tc.attempts; i++ {
+				e, _ := o.Store.Get(id)
+				now = e.NextAttempt
+				o.deliver(id)
+			}
+			if len(s.sent) != tc.attempts {
+				t.Errorf("expected %d attempts got %d", tc.attempts, len(s.sent))
+			}
+
+			e, err := o.Store.Get(id)
+			if tc.pending != (err == nil) {
+				t.Errorf("expected pending %v got %v", tc.pending, err == nil)
+			}
+			if tc.pending && !e.NextAttempt.Equal(tc.nextAttempt) {
+				t.Errorf("expected next attempt %v got %v", tc.nextAttempt, e.NextAttempt)
+			}
+			xd, _ := o.Store.Dead()
+			if tc.dead != (len(xd) == 1) {
+				t.Errorf("expected dead %v got %v", tc.dead, xd)
+			}
+			if tc.dead && (xd[0].Attempts != tc.attempts || xd[0].LastError == "") {
+				t.Errorf("expected dead letter with %d attempts and the error got %v", tc.attempts, xd[0])
+			}
+		})
+	}
+}
+
+func TestOutbox_deliver_panic(t *testing.T) {
+	o := newOutbox(t, &sender{}, 3)
+	o.send = func(m *emailserv.Message) dutil.Error {
+		var res *struct{ Body string }
+		_ = res.Body
+		return nil
+	}
+	_ = o.Enqueue(&emailserv.Message{Subject: "test"})
+	xe, _ := o.Store.Pending()
+	o.deliver(xe[0].ID)
+
+	e, err := o.Store.Get(xe[0].ID)
+	if err != nil || e.Attempts != 1 || e.LastError == "" {
+		t.Errorf("expected the panic to be retried got %v %v", e, err)
+	}
+}
+
+func TestOutbox_backoff(t *testing.T) {
+	o := New(nil, nil, Options{BackoffBase: 10 * time.Second, BackoffMax: time.Minute})
+	E := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, d := range E {
+		if o.backoff(i+1) != d {
+			t.Errorf("expected backoff %v after %d attempts got %v", d, i+1, o.backoff(i+1))
+		}
+	}
+}
+
+func TestOutbox_Run(t *testing.T) {
+	s := &sender{}
+	o := newOutbox(t, s, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+
+	for _, subject := range []string{"one", "two", "three"} {
+		_ = o.Enqueue(&emailserv.Message{Subject: subject})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		xe, _ := o.Store.Pending()
+		if len(xe) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	xe, _ := o.Store.Pending()
+	if len(xe) != 0 {
+		t.Errorf("expected all emails delivered got %d pending", len(xe))
+	}
+	if len(s.sent) != 3 {
+		t.Errorf("expected %d emails sent exactly once got %v", 3, s.sent)
+	}
+}
+
+func TestOutbox_Requeue(t *testing.T) {
+	s := &sender{errors: []dutil.Error{dutil.NewErr(400, "to", []string{"required"})}}
+	o := newOutbox(t, s, 3)
+	_ = o.Enqueue(&emailserv.Message{Subject: "test"})
+	xe, _ := o.Store.Pending()
+	o.deliver(xe[0].ID)
+
+	_, err := o.Requeue(xe[0].ID)
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	o.deliver(xe[0].ID)
+	if len(s.sent) != 2 {
+		t.Errorf("expected the requeued email to be sent again got %v", s.sent)
+	}
+	_, err = o.Requeue("does-not-exist")
+	if err != ErrNotFound {
+		t.Errorf("expected error %v got %v", ErrNotFound, err)
+	}
+}
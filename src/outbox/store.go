@@ -0,0 +1,295 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dottics/emailserv"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when an entry is not in the store.
+var ErrNotFound = errors.New("outbox entry not found")
+
+// Entry is an email in the outbox with its delivery attempts.
+type Entry struct {
+	ID          string             `json:"id"`
+	Message     *emailserv.Message `json:"message"`
+	Attempts    int                `json:"attempts"`
+	NextAttempt time.Time          `json:"next_attempt"`
+	LastError   string             `json:"last_error"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// Summary is an Entry without the message body and headers, used to list
+// the entries.
+type Summary struct {
+	ID          string    `json:"id"`
+	To          []string  `json:"to"`
+	Subject     string    `json:"subject"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Summary returns the summary of the entry.
+func (e Entry) Summary() Summary {
+	s := Summary{
+		ID:          e.ID,
+		To:          make([]string, 0),
+		Attempts:    e.Attempts,
+		NextAttempt: e.NextAttempt,
+		LastError:   e.LastError,
+		CreatedAt:   e.CreatedAt,
+	}
+	if e.Message != nil {
+		for _, a := range e.Message.To {
+			s.To = append(s.To, a.Address)
+		}
+		s.Subject = e.Message.Subject
+	}
+	return s
+}
+
+// Store persists the entries of the outbox as JSON files in the pending
+// and dead directories of its directory. Each file is written and synced
+// to a temporary file and renamed so that an entry is never partially
+// written. The files are only readable by the gateway, they hold the
+// addresses and bodies of the emails. The Store keeps an index of when
+// each pending entry is due so that the due entries are found without
+// reading the files, the Store must be the only writer of its directory.
+type Store struct {
+	mu      sync.Mutex
+	dir     string
+	pending map[string]time.Time
+}
+
+// NewStore creates the store in the directory dir, the directory is
+// created if it does not exist. The index of the pending entries is read
+// from the directory, an entry which cannot be read is moved to the dead
+// letters.
+func NewStore(dir string) (*Store, error) {
+	for _, d := range []string{"", "pending", "dead"} {
+		err := os.MkdirAll(filepath.Join(dir, d), 0700)
+		if err != nil {
+			return nil, err
+		}
+		// tighten the directories of an existing store
+		err = os.Chmod(filepath.Join(dir, d), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := &Store{dir: dir, pending: make(map[string]time.Time)}
+	xe, err := s.list("pending")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range xe {
+		s.pending[e.ID] = e.NextAttempt
+	}
+	return s, nil
+}
+
+// Put writes the pending entry e, replacing the entry with the same ID.
+func (s *Store) Put(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.write("pending", e)
+	if err != nil {
+		return err
+	}
+	s.pending[e.ID] = e.NextAttempt
+	return nil
+}
+
+// Get returns the pending entry with the id.
+func (s *Store) Get(id string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.read(s.path("pending", id))
+	if os.IsNotExist(err) {
+		return Entry{}, ErrNotFound
+	}
+	return e, err
+}
+
+// Delete removes the pending entry with the id.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+	err := os.Remove(s.path("pending", id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Bury moves the entry e from pending to the dead letters.
+func (s *Store) Bury(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.write("dead", e)
+	if err != nil {
+		return err
+	}
+	delete(s.pending, e.ID)
+	err = os.Remove(s.path("pending", e.ID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Requeue moves the dead letter with the id back to pending with its
+// attempts reset so that it is delivered at next.
+func (s *Store) Requeue(id string, next time.Time) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.read(s.path("dead", id))
+	if os.IsNotExist(err) {
+		return Entry{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Attempts = 0
+	e.NextAttempt = next
+	e.LastError = ""
+	err = s.write("pending", e)
+	if err != nil {
+		return Entry{}, err
+	}
+	s.pending[e.ID] = e.NextAttempt
+	return e, os.Remove(s.path("dead", id))
+}
+
+// Due returns the IDs of the pending entries of which the next attempt is
+// at or before now, ordered by their next attempt. The entries are found
+// from the index without reading the files.
+func (s *Store) Due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	xs := make([]string, 0)
+	for id, next := range s.pending {
+		if !next.After(now) {
+			xs = append(xs, id)
+		}
+	}
+	sort.Slice(xs, func(i, j int) bool {
+		return s.pending[xs[i]].Before(s.pending[xs[j]])
+	})
+	return xs
+}
+
+// Pending returns the pending entries ordered by their next attempt.
+func (s *Store) Pending() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	xe, err := s.list("pending")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(xe, func(i, j int) bool {
+		return xe[i].NextAttempt.Before(xe[j].NextAttempt)
+	})
+	return xe, nil
+}
+
+// Dead returns the dead letters ordered by when they were created.
+func (s *Store) Dead() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	xe, err := s.list("dead")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(xe, func(i, j int) bool {
+		return xe[i].CreatedAt.Before(xe[j].CreatedAt)
+	})
+	return xe, nil
+}
+
+func (s *Store) path(state, id string) string {
+	return filepath.Join(s.dir, state, filepath.Base(id)+".json")
+}
+
+func (s *Store) write(state string, e Entry) error {
+	xb, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(state, e.ID) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(xb)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.path(state, e.ID))
+}
+
+func (s *Store) read(name string) (Entry, error) {
+	e := Entry{}
+	xb, err := os.ReadFile(name)
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal(xb, &e)
+	return e, err
+}
+
+// list reads the entries of the state. A pending entry which cannot be
+// read is moved to the dead letters, a dead letter which cannot be read
+// is listed with the error so that it can be inspected.
+func (s *Store) list(state string) ([]Entry, error) {
+	xd, err := os.ReadDir(filepath.Join(s.dir, state))
+	if err != nil {
+		return nil, err
+	}
+	xe := make([]Entry, 0, len(xd))
+	for _, d := range xd {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			continue
+		}
+		name := filepath.Join(s.dir, state, d.Name())
+		e, err := s.read(name)
+		if err == nil {
+			xe = append(xe, e)
+			continue
+		}
+		id := strings.TrimSuffix(d.Name(), ".json")
+		if state == "pending" {
+			log.Printf("outbox: %s unreadable, moved to the dead letters: %v\n", id, err)
+			delete(s.pending, id)
+			err = os.Rename(name, s.path("dead", id))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		e = Entry{ID: id, LastError: fmt.Sprintf("unreadable entry: %v", err)}
+		if fi, err := d.Info(); err == nil {
+			e.CreatedAt = fi.ModTime()
+		}
+		xe = append(xe, e)
+	}
+	return xe, nil
+}
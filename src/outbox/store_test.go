@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"fmt"
+	"github.com/dottics/emailserv"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(filepath.Join(dir, "outbox"))
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	m := &emailserv.Message{
+		To:      []mail.Address{{Name: "James Bond", Address: "james@bond.com"}},
+		Subject: "Dottics Forgot Password",
+		Body:    "body",
+	}
+	a := Entry{ID: "a", Message: m, NextAttempt: now.Add(time.Minute), CreatedAt: now}
+	b := Entry{ID: "b", Message: m, NextAttempt: now, CreatedAt: now.Add(time.Second)}
+	for _, e := range []Entry{a, b} {
+		err = s.Put(e)
+		if err != nil {
+			t.Fatalf("expected error %v got %v", nil, err)
+		}
+	}
+
+	xe, _ := s.Pending()
+	if len(xe) != 2 || xe[0].ID != "b" || xe[1].ID != "a" {
+		t.Errorf("expected pending [b a] ordered by next attempt got %v", xe)
+	}
+	e, err := s.Get("a")
+	if err != nil || e.Message.Subject != m.Subject || !e.NextAttempt.Equal(a.NextAttempt) {
+		t.Errorf("expected entry %v got %v %v", a, e, err)
+	}
+
+	// a dead letter is no longer pending
+	a.Attempts = 3
+	a.LastError = "map[email:[unavailable]]"
+	err = s.Bury(a)
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	xe, _ = s.Pending()
+	if len(xe) != 1 || xe[0].ID != "b" {
+		t.Errorf("expected pending [b] got %v", xe)
+	}
+	xd, _ := s.Dead()
+	if len(xd) != 1 || xd[0].ID != "a" || xd[0].Attempts != 3 {
+		t.Errorf("expected dead [a] got %v", xd)
+	}
+
+	// requeue resets the attempts
+	e, err = s.Requeue("a", now)
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	if e.Attempts != 0 || e.LastError != "" || !e.NextAttempt.Equal(now) {
+		t.Errorf("expected requeued entry to be reset got %v", e)
+	}
+	xd, _ = s.Dead()
+	if len(xd) != 0 {
+		t.Errorf("expected no dead letters got %v", xd)
+	}
+	_, err = s.Requeue("a", now)
+	if err != ErrNotFound {
+		t.Errorf("expected error %v got %v", ErrNotFound, err)
+	}
+
+	err = s.Delete("b")
+	if err != nil {
+		t.Errorf("expected error %v got %v", nil, err)
+	}
+	_, err = s.Get("b")
+	if err != ErrNotFound {
+		t.Errorf("expected error %v got %v", ErrNotFound, err)
+	}
+
+	// the entries survive a new store on the same directory
+	s, _ = NewStore(filepath.Join(dir, "outbox"))
+	xe, _ = s.Pending()
+	if len(xe) != 1 || xe[0].ID != "a" {
+		t.Errorf("expected pending [a] got %v", xe)
+	}
+	xf, _ := os.ReadDir(filepath.Join(dir, "outbox", "pending"))
+	if len(xf) != 1 {
+		t.Errorf("expected %d file without temporary files got %d", 1, len(xf))
+	}
+
+	// the files and directories are only accessible by the gateway
+	for name, mode := range map[string]os.FileMode{
+		filepath.Join(dir, "outbox"):                      0700,
+		filepath.Join(dir, "outbox", "pending"):           0700,
+		filepath.Join(dir, "outbox", "pending", "a.json"): 0600,
+	} {
+		fi, err := os.Stat(name)
+		if err != nil || fi.Mode().Perm() != mode {
+			t.Errorf("expected %s to have mode %v got %v %v", name, mode, fi.Mode().Perm(), err)
+		}
+	}
+}
+
+func TestStore_Due(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewStore(dir)
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	_ = s.Put(Entry{ID: "a", NextAttempt: now})
+	_ = s.Put(Entry{ID: "b", NextAttempt: now.Add(-time.Minute)})
+	_ = s.Put(Entry{ID: "c", NextAttempt: now.Add(time.Minute)})
+
+	if xs := s.Due(now); fmt.Sprint(xs) != "[b a]" {
+		t.Errorf("expected due [b a] got %v", xs)
+	}
+	_ = s.Delete("b")
+	_ = s.Bury(Entry{ID: "a"})
+	if xs := s.Due(now.Add(time.Minute)); fmt.Sprint(xs) != "[c]" {
+		t.Errorf("expected due [c] got %v", xs)
+	}
+	_, _ = s.Requeue("a", now)
+	if xs := s.Due(now); fmt.Sprint(xs) != "[a]" {
+		t.Errorf("expected due [a] got %v", xs)
+	}
+
+	// the index is read from the directory by a new store
+	s, _ = NewStore(dir)
+	if xs := s.Due(now.Add(time.Minute)); fmt.Sprint(xs) != "[a c]" {
+		t.Errorf("expected due [a c] got %v", xs)
+	}
+}
+
+func TestStore_unreadable(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewStore(dir)
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	_ = s.Put(Entry{ID: "a", NextAttempt: now})
+	_ = os.WriteFile(filepath.Join(dir, "pending", "b.json"), []byte("{"), 0600)
+
+	// an unreadable entry does not stop the other entries
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("expected error %v got %v", nil, err)
+	}
+	xe, err := s.Pending()
+	if err != nil || len(xe) != 1 || xe[0].ID != "a" {
+		t.Errorf("expected pending [a] got %v %v", xe, err)
+	}
+	if xs := s.Due(now); fmt.Sprint(xs) != "[a]" {
+		t.Errorf("expected due [a] got %v", xs)
+	}
+	xd, err := s.Dead()
+	if err != nil || len(xd) != 1 || xd[0].ID != "b" || !strings.HasPrefix(xd[0].LastError, "unreadable entry") {
+		t.Errorf("expected the unreadable dead letter b got %v %v", xd, err)
+	}
+}
+
+func TestEntry_Summary(t *testing.T) {
+	e := Entry{
+		ID: "a",
+		Message: &emailserv.Message{
+			To:      []mail.Address{{Name: "James Bond", Address: "james@bond.com"}},
+			Subject: "Dottics Contact Us",
+			Body:    "body",
+		},
+		Attempts: 2,
+	}
+	s := e.Summary()
+	if s.ID != "a" || len(s.To) != 1 || s.To[0] != "james@bond.com" || s.Subject != "Dottics Contact Us" || s.Attempts != 2 {
+		t.Errorf("expected summary of the entry got %v", s)
+	}
+}
@@ -0,0 +1,128 @@
+package src
+
+import (
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	security "github.com/dottics/securityserv"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Permission is the set of permission codes a user requires to access a
+// route. If All is true the user requires every code, otherwise the user
+// requires at least one of the codes. A Permission without codes only
+// requires the user to be authenticated.
+type Permission struct {
+	All   bool
+	Codes []string
+}
+
+// AnyOf returns a Permission which requires at least one of the codes.
+func AnyOf(codes ...string) Permission {
+	return Permission{Codes: codes}
+}
+
+// AllOf returns a Permission which requires all the codes.
+func AllOf(codes ...string) Permission {
+	return Permission{All: true, Codes: codes}
+}
+
+// Allow reports whether the permission codes xs satisfy the Permission.
+func (p Permission) Allow(xs security.PermissionCodes) bool {
+	if len(p.Codes) == 0 {
+		return true
+	}
+	has := make(map[string]bool, len(xs))
+	for _, x := range xs {
+		has[x] = true
+	}
+	for _, code := range p.Codes {
+		if has[code] && !p.All {
+			return true
+		}
+		if !has[code] && p.All {
+			return false
+		}
+	}
+	return p.All
+}
+
+// String returns the human-readable description of the Permission.
+func (p Permission) String() string {
+	if len(p.Codes) == 0 {
+		return "authenticated"
+	}
+	if p.All {
+		return fmt.Sprintf("all-of [%s]", strings.Join(p.Codes, ", "))
+	}
+	return fmt.Sprintf("any-of [%s]", strings.Join(p.Codes, ", "))
+}
+
+// RoutePermission is a single entry of the route-to-permission table.
+type RoutePermission struct {
+	Path       string
+	Methods    []string
+	Permission string
+}
+
+// protect registers a route which may only be accessed by an authenticated
+// user who has the permission p.
+func (s *Server) protect(path string, p Permission, f http.HandlerFunc) *mux.Route {
+	route := s.Router.HandleFunc(path, s.prop(s.authenticate(s.authorize(p, f))))
+	s.permissions[route] = p
+	return route
+}
+
+// authorize checks that the permission codes of the authenticated user
+// satisfy the permission p before calling the handler function f. It
+// requires the request to have passed through authenticate.
+func (s *Server) authorize(p Permission, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := handler.SessionFrom(r)
+		if !ok {
+			e := dutil.NewErr(401, "authentication", []string{"token required", "please login"})
+			handler.Error(w, r, e)
+			return
+		}
+		if !p.Allow(session.PermissionCodes) {
+			e := dutil.NewErr(403, "permission", []string{"insufficient permission", p.String()})
+			handler.Error(w, r, e)
+			return
+		}
+		f(w, r)
+	}
+}
+
+// PermissionTable lists every registered route with the permission
+// required to access the route.
+func (s *Server) PermissionTable() []RoutePermission {
+	xrp := make([]RoutePermission, 0)
+	_ = s.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		rp := RoutePermission{
+			Path:       path,
+			Methods:    methods,
+			Permission: "public",
+		}
+		if p, ok := s.permissions[route]; ok {
+			rp.Permission = p.String()
+		}
+		xrp = append(xrp, rp)
+		return nil
+	})
+	return xrp
+}
+
+// LogPermissions logs the route-to-permission table for auditing.
+func (s *Server) LogPermissions() {
+	for _, rp := range s.PermissionTable() {
+		log.Printf("route %-20s %-20s %s\n", rp.Path, strings.Join(rp.Methods, ","), rp.Permission)
+	}
+}
@@ -0,0 +1,152 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	security "github.com/dottics/securityserv"
+	"github.com/gorilla/mux"
+	"github.com/johannesscr/micro/microtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPermission_Allow(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission Permission
+		codes      security.PermissionCodes
+		allow      bool
+	}{
+		{name: "authenticated", permission: AnyOf(), codes: nil, allow: true},
+		{name: "any-of none", permission: AnyOf("aio2", "91j8"), codes: security.PermissionCodes{"s1ga"}, allow: false},
+		{name: "any-of one", permission: AnyOf("aio2", "91j8"), codes: security.PermissionCodes{"s1ga", "91j8"}, allow: true},
+		{name: "all-of some", permission: AllOf("aio2", "91j8"), codes: security.PermissionCodes{"aio2"}, allow: false},
+		{name: "all-of all", permission: AllOf("aio2", "91j8"), codes: security.PermissionCodes{"91j8", "s1ga", "aio2"}, allow: true},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			allow := tc.permission.Allow(tc.codes)
+			if allow != tc.allow {
+				t.Errorf("expected allow %v got %v", tc.allow, allow)
+			}
+		})
+	}
+}
+
+func TestPermission_String(t *testing.T) {
+	tests := []struct {
+		permission Permission
+		s          string
+	}{
+		{permission: AnyOf(), s: "authenticated"},
+		{permission: AnyOf("aio2", "91j8"), s: "any-of [aio2, 91j8]"},
+		{permission: AllOf("aio2", "91j8"), s: "all-of [aio2, 91j8]"},
+	}
+
+	for _, tc := range tests {
+		if tc.permission.String() != tc.s {
+			t.Errorf("expected '%s' got '%s'", tc.s, tc.permission.String())
+		}
+	}
+}
+
+func TestServer_authorize(t *testing.T) {
+	type E struct {
+		status int
+		data   string
+	}
+	tests := []struct {
+		name    string
+		session *includes.Session
+		E       E
+	}{
+		{
+			name:    "not authenticated",
+			session: nil,
+			E: E{
+				status: 401,
+				data:   `{"message":"Unauthorized","data":null,"errors":{"authentication":["token required","please login"]}}`,
+			},
+		},
+		{
+			name:    "forbidden",
+			session: &includes.Session{PermissionCodes: security.PermissionCodes{"s1ga"}},
+			E: E{
+				status: 403,
+				data:   `{"message":"Forbidden","data":null,"errors":{"permission":["insufficient permission","any-of [aio2]"]}}`,
+			},
+		},
+		{
+			name:    "allowed",
+			session: &includes.Session{PermissionCodes: security.PermissionCodes{"aio2"}},
+			E: E{
+				status: 200,
+				data:   `{"message":"allowed","data":null,"errors":null}`,
+			},
+		},
+	}
+
+	s := &Server{}
+	f := s.authorize(AnyOf("aio2"), func(w http.ResponseWriter, r *http.Request) {
+		resp := dutil.Resp{Status: 200, Message: "allowed"}
+		resp.Respond(w, r)
+	})
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.session != nil {
+				req = handler.WithSession(req, *tc.session)
+			}
+			rec := httptest.NewRecorder()
+			f(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+		})
+	}
+}
+
+func TestServer_PermissionTable(t *testing.T) {
+	s := &Server{
+		Router:      mux.NewRouter(),
+		CORS:        &CORS{AllowedOrigins: []string{"*"}},
+		permissions: make(map[*mux.Route]Permission),
+	}
+	s.Router.HandleFunc("/public", s.prop(handler.Home)).Methods("OPTIONS", "GET")
+	s.protect("/private", AllOf("aio2", "91j8"), handler.Home).Methods("OPTIONS", "POST")
+
+	xrp := s.PermissionTable()
+	if len(xrp) != 2 {
+		t.Fatalf("expected %d routes got %d", 2, len(xrp))
+	}
+	tests := []RoutePermission{
+		{Path: "/public", Methods: []string{"OPTIONS", "GET"}, Permission: "public"},
+		{Path: "/private", Methods: []string{"OPTIONS", "POST"}, Permission: "all-of [aio2, 91j8]"},
+	}
+	for i, rp := range tests {
+		if xrp[i].Path != rp.Path {
+			t.Errorf("expected path '%s' got '%s'", rp.Path, xrp[i].Path)
+		}
+		if strings.Join(xrp[i].Methods, ",") != strings.Join(rp.Methods, ",") {
+			t.Errorf("expected methods %v got %v", rp.Methods, xrp[i].Methods)
+		}
+		if xrp[i].Permission != rp.Permission {
+			t.Errorf("expected permission '%s' got '%s'", rp.Permission, xrp[i].Permission)
+		}
+	}
+}
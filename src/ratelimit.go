@@ -0,0 +1,154 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateRule is a rate limit applied to a route. The Key function returns
+// the bucket of the request, if the key is empty the rule does not apply
+// to the request.
+type RateRule struct {
+	Name  string
+	Limit ratelimit.Limit
+	Key   func(r *http.Request) string
+}
+
+// rateRules returns the per-IP and per-email rate limit rules configured
+// for the route. A route without any configured limits is not limited.
+func (s *Server) rateRules(route string) []RateRule {
+	keys := map[string]func(r *http.Request) string{
+		"ip":    s.clientIP,
+		"email": requestEmail,
+	}
+	xr := make([]RateRule, 0)
+	for _, bucket := range []string{"ip", "email"} {
+		name := route + ":" + bucket
+		l, ok := s.Config.RateLimit.Limits[name]
+		if !ok {
+			continue
+		}
+		xr = append(xr, RateRule{
+			Name:  name,
+			Limit: l,
+			Key:   keys[bucket],
+		})
+	}
+	return xr
+}
+
+// limit applies the rate limits configured for the route to the handler
+// function f. A request which exceeds any of the limits is rejected with
+// a 429 and a Retry-After header. Every limit is checked before any is
+// recorded, so that a request rejected by one limit does not count
+// against the others.
+func (s *Server) limit(route string, f http.HandlerFunc) http.HandlerFunc {
+	rules := s.rateRules(route)
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := make([]string, len(rules))
+		for i, rule := range rules {
+			key := rule.Key(r)
+			if key == "" {
+				continue
+			}
+			keys[i] = rule.Name + ":" + key
+			ok, retry := s.Limiter.Peek(r.Context(), keys[i], rule.Limit)
+			if !ok {
+				tooManyRequests(w, r, retry)
+				return
+			}
+		}
+		for i, rule := range rules {
+			if keys[i] == "" {
+				continue
+			}
+			ok, retry := s.Limiter.Allow(r.Context(), keys[i], rule.Limit)
+			if !ok {
+				tooManyRequests(w, r, retry)
+				return
+			}
+		}
+		f(w, r)
+	}
+}
+
+// tooManyRequests rejects the request with a 429 and a Retry-After header
+// of the retry duration.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retry time.Duration) {
+	seconds := int(math.Ceil(retry.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	e := dutil.NewErr(429, "rate_limit", []string{
+		"too many requests",
+		fmt.Sprintf("retry after %d seconds", seconds),
+	})
+	handler.Error(w, r, e)
+}
+
+// clientIP returns the IP address of the client. The X-Forwarded-For
+// header is only trusted if the gateway is configured to be behind a
+// proxy, in which case the rightmost address, which is appended by the
+// trusted proxy, is the client. The addresses to its left are set by the
+// client and cannot be trusted.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.Config.RateLimit.TrustProxy {
+		xs := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(xs) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(xs[i])
+			if ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestEmailMaxBytes limits the size of the request body read for the
+// email.
+const requestEmailMaxBytes = 64 << 10
+
+// requestEmail returns the lower-case email of the JSON request body. The
+// body is restored so that it can be decoded again by the handler. A body
+// larger than requestEmailMaxBytes has no email and the handler receives
+// the error of reading the body.
+func requestEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	xb, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, requestEmailMaxBytes))
+	_ = r.Body.Close()
+	if err != nil {
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(xb), errReader{err}))
+		return ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(xb))
+
+	p := struct {
+		Email string `json:"email"`
+	}{}
+	_ = json.Unmarshal(xb, &p)
+	return strings.ToLower(strings.TrimSpace(p.Email))
+}
+
+// errReader is a reader which fails with the error.
+type errReader struct {
+	err error
+}
+
+func (e errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process sliding window rate limit store. The limits are
+// not shared across gateway replicas.
+type Memory struct {
+	mu    sync.Mutex
+	keys  map[string]*window
+	calls int
+	now   func() time.Time
+}
+
+// window is the times of the requests of a key within the window of the
+// limit of the key.
+type window struct {
+	times  []time.Time
+	length time.Duration
+}
+
+// NewMemory creates an empty in-process rate limit store.
+func NewMemory() *Memory {
+	return &Memory{
+		keys: make(map[string]*window),
+		now:  time.Now,
+	}
+}
+
+func (m *Memory) Allow(_ context.Context, key string, limit Limit) (bool, time.Duration) {
+	return m.allow(key, limit, true)
+}
+
+func (m *Memory) Peek(_ context.Context, key string, limit Limit) (bool, time.Duration) {
+	return m.allow(key, limit, false)
+}
+
+// allow reports whether a request for the key is within the limit and
+// records the request if it is allowed and record is set.
+func (m *Memory) allow(key string, limit Limit, record bool) (bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.calls++
+	if m.calls%1000 == 0 {
+		m.sweep(now)
+	}
+
+	w, ok := m.keys[key]
+	if !ok {
+		w = &window{}
+		m.keys[key] = w
+	}
+	if limit.Window > w.length {
+		w.length = limit.Window
+	}
+	w.times = prune(w.times, now.Add(-limit.Window))
+	if len(w.times) >= limit.Requests {
+		return false, w.times[0].Add(limit.Window).Sub(now)
+	}
+	if record {
+		w.times = append(w.times, now)
+	}
+	return true, 0
+}
+
+// sweep removes the keys of which the last request is outside the window
+// of the limit of the key, so that the store does not grow without bound.
+func (m *Memory) sweep(now time.Time) {
+	for key, w := range m.keys {
+		if len(w.times) == 0 || now.Sub(w.times[len(w.times)-1]) > w.length {
+			delete(m.keys, key)
+		}
+	}
+}
+
+// prune removes the times before the start of the window.
+func prune(xt []time.Time, start time.Time) []time.Time {
+	i := 0
+	for i < len(xt) && !xt[i].After(start) {
+		i++
+	}
+	return xt[i:]
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory_Allow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	l := Limit{Requests: 2, Window: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		ok, _ := m.Allow(ctx, "a", l)
+		if !ok {
+			t.Errorf("expected request %d to be allowed", i)
+		}
+		now = now.Add(10 * time.Second)
+	}
+	ok, retry := m.Allow(ctx, "a", l)
+	if ok {
+		t.Errorf("expected request to be limited")
+	}
+	if retry != 40*time.Second {
+		t.Errorf("expected retry after %v got %v", 40*time.Second, retry)
+	}
+	// a different key has its own bucket
+	ok, _ = m.Allow(ctx, "b", l)
+	if !ok {
+		t.Errorf("expected request for another key to be allowed")
+	}
+
+	now = now.Add(41 * time.Second)
+	ok, _ = m.Allow(ctx, "a", l)
+	if !ok {
+		t.Errorf("expected request to be allowed once the window slides")
+	}
+}
+
+func TestMemory_Peek(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	l := Limit{Requests: 1, Window: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		ok, _ := m.Peek(ctx, "a", l)
+		if !ok {
+			t.Errorf("expected peek %d to be allowed", i)
+		}
+	}
+	m.Allow(ctx, "a", l)
+	ok, retry := m.Peek(ctx, "a", l)
+	if ok || retry <= 0 {
+		t.Errorf("expected peek to be limited got %v %v", ok, retry)
+	}
+}
+
+func TestMemory_sweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	day := Limit{Requests: 1, Window: 24 * time.Hour}
+	minute := Limit{Requests: 1, Window: time.Minute}
+
+	m.Allow(ctx, "day", day)
+	m.Allow(ctx, "minute", minute)
+	now = now.Add(2 * time.Hour)
+	m.sweep(now)
+
+	if _, ok := m.keys["minute"]; ok {
+		t.Errorf("expected the key outside its window to be swept")
+	}
+	ok, _ := m.Allow(ctx, "day", day)
+	if ok {
+		t.Errorf("expected the 24h limit to hold past a sweep")
+	}
+	now = now.Add(23 * time.Hour)
+	m.sweep(now)
+	if _, ok := m.keys["day"]; ok {
+		t.Errorf("expected the key to be swept once its window passed")
+	}
+}
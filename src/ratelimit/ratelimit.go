@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is the maximum number of Requests allowed in a sliding Window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ParseLimit parses a limit of the form "<requests>/<window>" such as
+// "5/15m" which allows 5 requests in any 15-minute window.
+func ParseLimit(s string) (Limit, error) {
+	xs := strings.Split(s, "/")
+	if len(xs) != 2 {
+		return Limit{}, fmt.Errorf("invalid limit '%s' expected <requests>/<window>", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(xs[0]))
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit '%s' requests must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(xs[1]))
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit '%s' window must be a positive duration", s)
+	}
+	return Limit{Requests: n, Window: d}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// Store keeps track of the requests made for each rate limit key.
+type Store interface {
+	// Allow records a request for the key and reports whether the request
+	// is within the limit. If the request is not allowed the duration
+	// after which the next request will be allowed is returned.
+	Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration)
+	// Peek reports whether a request for the key would be within the limit
+	// without recording the request.
+	Peek(ctx context.Context, key string, limit Limit) (bool, time.Duration)
+}
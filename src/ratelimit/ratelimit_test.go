@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		limit Limit
+		err   bool
+	}{
+		{name: "valid", s: "5/15m", limit: Limit{Requests: 5, Window: 15 * time.Minute}},
+		{name: "spaces", s: " 10 / 1h ", limit: Limit{Requests: 10, Window: time.Hour}},
+		{name: "missing window", s: "5", err: true},
+		{name: "invalid requests", s: "0/1m", err: true},
+		{name: "invalid window", s: "5/fortnight", err: true},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			l, err := ParseLimit(tc.s)
+			if (err != nil) != tc.err {
+				t.Errorf("expected error %v got %v", tc.err, err)
+			}
+			if l != tc.limit {
+				t.Errorf("expected limit %v got %v", tc.limit, l)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+// allowScript removes the requests before the start of the window of the
+// sorted set KEYS[1], counts the remaining requests and, if the request is
+// within the limit and ARGV[6] is "1", adds the request. The trim, count
+// and add are atomic so that concurrent replicas cannot exceed the limit.
+// It returns 0 if the request is allowed, otherwise the time of the oldest
+// request in the window in microseconds, or -1 if it is unknown.
+//
+// ARGV: now, start of the window, requests, window in ms, member, record.
+var allowScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	if #oldest == 0 then
+		return -1
+	end
+	return tonumber(oldest[2])
+end
+if ARGV[6] == '1' then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[5])
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return 0
+`)
+
+// Redis is a sliding window rate limit store which is shared by all the
+// gateway replicas connected to the same Redis instance. Each key is a
+// sorted set of request times in microseconds. If Redis is unavailable the request is
+// allowed so that the gateway does not fail closed.
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+	now    func() time.Time
+}
+
+// NewRedis creates a rate limit store backed by the Redis client.
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{
+		Client: client,
+		Prefix: "flight-log-api-gateway:ratelimit:",
+		now:    time.Now,
+	}
+}
+
+func (s *Redis) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration) {
+	return s.allow(ctx, key, limit, true)
+}
+
+func (s *Redis) Peek(ctx context.Context, key string, limit Limit) (bool, time.Duration) {
+	return s.allow(ctx, key, limit, false)
+}
+
+// allow runs the allowScript for the key, the request is recorded if it
+// is allowed and record is set.
+func (s *Redis) allow(ctx context.Context, key string, limit Limit, record bool) (bool, time.Duration) {
+	now := s.now()
+	r := "0"
+	if record {
+		r = "1"
+	}
+	oldest, err := allowScript.Run(ctx, s.Client, []string{s.Prefix + key},
+		now.UnixMicro(),
+		now.Add(-limit.Window).UnixMicro(),
+		limit.Requests,
+		limit.Window.Milliseconds(),
+		fmt.Sprintf("%d-%s", now.UnixMicro(), uuid.NewString()),
+		r,
+	).Int64()
+	if err != nil {
+		log.Println("rate limit:", err)
+		return true, 0
+	}
+
+	switch {
+	case oldest == 0:
+		return true, 0
+	case oldest < 0:
+		return false, limit.Window
+	}
+	first := time.UnixMicro(oldest)
+	return false, first.Add(limit.Window).Sub(now)
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func TestRedis_Allow(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	s := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	s.now = func() time.Time { return now }
+	l := Limit{Requests: 2, Window: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		ok, _ := s.Allow(ctx, "a", l)
+		if !ok {
+			t.Errorf("expected request %d to be allowed", i)
+		}
+		now = now.Add(10 * time.Second)
+	}
+	ok, retry := s.Allow(ctx, "a", l)
+	if ok {
+		t.Errorf("expected request to be limited")
+	}
+	if retry != 40*time.Second {
+		t.Errorf("expected retry after %v got %v", 40*time.Second, retry)
+	}
+	ok, _ = s.Allow(ctx, "b", l)
+	if !ok {
+		t.Errorf("expected request for another key to be allowed")
+	}
+
+	now = now.Add(41 * time.Second)
+	ok, _ = s.Allow(ctx, "a", l)
+	if !ok {
+		t.Errorf("expected request to be allowed once the window slides")
+	}
+}
+
+func TestRedis_Peek(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	s := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	l := Limit{Requests: 1, Window: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		ok, _ := s.Peek(ctx, "a", l)
+		if !ok {
+			t.Errorf("expected peek %d to be allowed", i)
+		}
+	}
+	s.Allow(ctx, "a", l)
+	ok, retry := s.Peek(ctx, "a", l)
+	if ok || retry <= 0 {
+		t.Errorf("expected peek to be limited got %v %v", ok, retry)
+	}
+}
+
+func TestRedis_AllowUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	mr.Close()
+
+	ok, _ := s.Allow(context.Background(), "a", Limit{Requests: 1, Window: time.Minute})
+	if !ok {
+		t.Errorf("expected request to be allowed when redis is unavailable")
+	}
+}
@@ -0,0 +1,191 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"github.com/johannesscr/micro/microtest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_limit(t *testing.T) {
+	type E struct {
+		status     int
+		data       string
+		retryAfter string
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		payload    string
+		E          E
+	}{
+		{
+			name:       "allowed",
+			remoteAddr: "10.0.0.1:5000",
+			payload:    `{"email":"james@bond.com"}`,
+			E: E{
+				status: 200,
+				data:   `{"message":"james@bond.com","data":null,"errors":null}`,
+			},
+		},
+		{
+			name:       "email limited",
+			remoteAddr: "10.0.0.2:5000",
+			payload:    `{"email":"James@Bond.com"}`,
+			E: E{
+				status:     429,
+				data:       `{"message":"Too Many Requests","data":null,"errors":{"rate_limit":["too many requests","retry after 3600 seconds"]}}`,
+				retryAfter: "3600",
+			},
+		},
+		{
+			name:       "other email allowed",
+			remoteAddr: "10.0.0.1:5000",
+			payload:    `{"email":"jane@bond.com"}`,
+			E: E{
+				status: 200,
+				data:   `{"message":"jane@bond.com","data":null,"errors":null}`,
+			},
+		},
+		{
+			name:       "no email allowed",
+			remoteAddr: "10.0.0.1:5000",
+			payload:    `{}`,
+			E: E{
+				status: 200,
+				data:   `{"message":"","data":null,"errors":null}`,
+			},
+		},
+		{
+			name:       "ip limited",
+			remoteAddr: "10.0.0.1:5000",
+			payload:    `{"email":"moneypenny@bond.com"}`,
+			E: E{
+				status:     429,
+				data:       `{"message":"Too Many Requests","data":null,"errors":{"rate_limit":["too many requests","retry after 3600 seconds"]}}`,
+				retryAfter: "3600",
+			},
+		},
+		{
+			name:       "email limited again",
+			remoteAddr: "10.0.0.2:5000",
+			payload:    `{"email":"james@bond.com"}`,
+			E: E{
+				status:     429,
+				data:       `{"message":"Too Many Requests","data":null,"errors":{"rate_limit":["too many requests","retry after 3600 seconds"]}}`,
+				retryAfter: "3600",
+			},
+		},
+		{
+			name:       "email limited once more",
+			remoteAddr: "10.0.0.2:5000",
+			payload:    `{"email":"james@bond.com"}`,
+			E: E{
+				status:     429,
+				data:       `{"message":"Too Many Requests","data":null,"errors":{"rate_limit":["too many requests","retry after 3600 seconds"]}}`,
+				retryAfter: "3600",
+			},
+		},
+		{
+			name:       "rejected requests not counted against the ip",
+			remoteAddr: "10.0.0.2:5000",
+			payload:    `{"email":"m@bond.com"}`,
+			E: E{
+				status: 200,
+				data:   `{"message":"m@bond.com","data":null,"errors":null}`,
+			},
+		},
+	}
+
+	s := &Server{
+		Config: &config.Config{
+			RateLimit: config.RateLimit{
+				Limits: map[string]ratelimit.Limit{
+					"forgot-password:ip":    {Requests: 3, Window: time.Hour},
+					"forgot-password:email": {Requests: 1, Window: time.Hour},
+				},
+			},
+		},
+		Limiter: ratelimit.NewMemory(),
+	}
+	f := s.limit("forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		p := struct {
+			Email string `json:"email"`
+		}{}
+		_ = dutil.Decode(w, r, &p)
+		resp := dutil.Resp{Status: 200, Message: p.Email}
+		resp.Respond(w, r)
+	})
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/forgot-password", io.NopCloser(strings.NewReader(tc.payload)))
+			req.RemoteAddr = tc.remoteAddr
+			rec := httptest.NewRecorder()
+			f(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.E.status {
+				t.Errorf("expected status code %d got %d", tc.E.status, res.StatusCode)
+			}
+			d := string(bytes.TrimSpace(xb))
+			if d != tc.E.data {
+				t.Errorf("expected data '%s' got '%s'", tc.E.data, d)
+			}
+			if res.Header.Get("Retry-After") != tc.E.retryAfter {
+				t.Errorf("expected Retry-After '%s' got '%s'", tc.E.retryAfter, res.Header.Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestServer_clientIP(t *testing.T) {
+	s := &Server{Config: &config.Config{}}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("X-Forwarded-For", "196.1.1.1, 10.0.0.1")
+
+	if ip := s.clientIP(req); ip != "10.0.0.1" {
+		t.Errorf("expected ip '%s' got '%s'", "10.0.0.1", ip)
+	}
+
+	s.Config.RateLimit.TrustProxy = true
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 196.1.1.1")
+	if ip := s.clientIP(req); ip != "196.1.1.1" {
+		t.Errorf("expected ip '%s' got '%s'", "196.1.1.1", ip)
+	}
+	// a client cannot spoof its address with the header
+	req.Header.Add("X-Forwarded-For", "196.1.1.2")
+	if ip := s.clientIP(req); ip != "196.1.1.2" {
+		t.Errorf("expected ip '%s' got '%s'", "196.1.1.2", ip)
+	}
+}
+
+func TestRequestEmail(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"email":" James@Bond.com "}`))
+	if email := requestEmail(req); email != "james@bond.com" {
+		t.Errorf("expected email '%s' got '%s'", "james@bond.com", email)
+	}
+	xb, _ := io.ReadAll(req.Body)
+	if string(xb) != `{"email":" James@Bond.com "}` {
+		t.Errorf("expected the body to be restored got '%s'", xb)
+	}
+
+	payload := `{"email":"james@bond.com","x":"` + strings.Repeat("x", requestEmailMaxBytes) + `"}`
+	req = httptest.NewRequest("POST", "/", strings.NewReader(payload))
+	if email := requestEmail(req); email != "" {
+		t.Errorf("expected no email got '%s'", email)
+	}
+	if _, err := io.ReadAll(req.Body); err == nil {
+		t.Errorf("expected the body to fail to be read")
+	}
+}
@@ -1,24 +1,118 @@
 package src
 
 import (
-	"github.com/dottics/dutil"
+	"context"
+	"github.com/dottics/flight-log-api-gateway/src/audit"
+	"github.com/dottics/flight-log-api-gateway/src/cache"
+	"github.com/dottics/flight-log-api-gateway/src/config"
 	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/dottics/flight-log-api-gateway/src/outbox"
+	"github.com/dottics/flight-log-api-gateway/src/ratelimit"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 	"net/http"
+	"sync"
+	"sync/atomic"
 )
 
 type Server struct {
-	Redis  bool
-	Router *mux.Router
+	Config       *config.Config
+	Redis        bool
+	RedisClient  *redis.Client
+	Router       *mux.Router
+	CORS         *CORS
+	Sessions     cache.Sessions
+	Limiter      ratelimit.Store
+	Suppressions suppression.Store
+	Recorder     audit.Recorder
+	Outbox       *outbox.Outbox
+	Probes       []Probe
+	permissions  map[*mux.Route]Permission
+
+	ready         atomic.Bool
+	background    sync.WaitGroup
+	serveHooks    []func(ctx context.Context)
+	shutdownHooks []func(ctx context.Context) error
 }
 
-func NewServer() *Server {
-	s := &Server{}
+// NewServer creates the Server from the configuration c and registers all
+// the routes. An error is returned if the email templates cannot be
+// parsed or the outbox cannot be created.
+func NewServer(c *config.Config) (*Server, error) {
+	s := &Server{Config: c}
 	s.Router = mux.NewRouter()
+	s.CORS = NewCORS(c.CORS)
+	s.permissions = make(map[*mux.Route]Permission)
+	err := includes.Configure(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Redis = c.Redis.Enabled
+	if s.Redis {
+		s.RedisClient = redis.NewClient(&redis.Options{
+			Addr:     c.Redis.Host,
+			Password: c.Redis.Password,
+		})
+	}
+	s.Sessions = s.sessionCache()
+	if s.Redis {
+		s.Limiter = ratelimit.NewRedis(s.RedisClient)
+		s.Suppressions = suppression.NewRedis(s.RedisClient)
+		s.Recorder = audit.NewRedis(s.RedisClient)
+	} else {
+		s.Limiter = ratelimit.NewMemory()
+		s.Suppressions = suppression.NewMemory()
+		s.Recorder = audit.NewLog()
+	}
+	includes.UseLimiter(s.Limiter)
+	includes.UseSuppressions(s.Suppressions)
+	includes.UseRecorder(s.Recorder)
+	err = s.newOutbox()
+	if err != nil {
+		return nil, err
+	}
+	s.Probes = s.newProbes()
 
 	// register routes
 	s.routes()
-	return s
+	return s, nil
+}
+
+// sessionCache creates the cache for validated tokens. The cache is shared
+// in Redis if Redis is enabled, otherwise the cache is in-process.
+func (s *Server) sessionCache() cache.Sessions {
+	if s.Redis {
+		return cache.NewRedis(s.RedisClient, s.Config.SessionCache.TTL)
+	}
+	return cache.NewLRU(s.Config.SessionCache.Size, s.Config.SessionCache.TTL)
+}
+
+// newOutbox creates the outbox of the emails if it is configured, the
+// outbox delivers the emails while the Server serves. Without an outbox
+// emails are sent synchronously.
+func (s *Server) newOutbox() error {
+	c := s.Config.Outbox
+	if c.Dir == "" {
+		includes.UseQueue(nil)
+		return nil
+	}
+	store, err := outbox.NewStore(c.Dir)
+	if err != nil {
+		return err
+	}
+	s.Outbox = outbox.New(store, includes.Deliver, outbox.Options{
+		Workers:      c.Workers,
+		MaxAttempts:  c.MaxAttempts,
+		BackoffBase:  c.BackoffBase,
+		BackoffMax:   c.BackoffMax,
+		PollInterval: c.PollInterval,
+	})
+	includes.UseQueue(s.Outbox)
+	s.OnServe(s.Outbox.Run)
+	return nil
 }
 
 // ServeHTTP is what makes the Server an HandlerFunc needed for the
@@ -32,12 +126,39 @@ func NewServer() *Server {
 // routes sets all the possible endpoints available on the API.
 func (s *Server) routes() {
 	s.Router.HandleFunc("/", s.prop(handler.Home)).Methods("OPTIONS", "GET")
+	s.Router.HandleFunc("/health/live", s.prop(handler.Live)).Methods("OPTIONS", "GET")
+	s.Router.HandleFunc("/health/ready", s.prop(s.readiness)).Methods("OPTIONS", "GET")
 	// Auth
-	s.Router.HandleFunc("/login", s.prop(handler.Login)).Methods("OPTIONS", "POST")
-	s.Router.HandleFunc("/logout", s.prop(handler.Logout)).Methods("OPTIONS", "DELETE")
-	s.Router.HandleFunc("/forgot-password", s.prop(handler.ForgotPassword)).Methods("OPTIONS", "POST")
+	s.Router.HandleFunc("/login", s.prop(s.limit("login", handler.Login))).Methods("OPTIONS", "POST")
+	s.protect("/logout", AnyOf(), s.endSession(handler.Logout)).Methods("OPTIONS", "DELETE")
+	s.Router.HandleFunc("/forgot-password", s.prop(s.limit("forgot-password", handler.ForgotPassword))).Methods("OPTIONS", "POST")
 	s.Router.HandleFunc("/reset-password", s.prop(handler.ResetPassword)).Methods("OPTIONS", "POST")
-	s.Router.HandleFunc("/contact-us", s.prop(handler.ContactUs)).Methods("OPTIONS", "POST")
+	s.Router.HandleFunc("/reset-password/token", s.prop(s.limit("reset-password-token", handler.ResetPasswordToken))).Methods("OPTIONS", "GET", "POST")
+	s.protect("/change-password", AnyOf(), s.evictSession(s.limit("change-password", handler.ChangePassword))).Methods("OPTIONS", "POST")
+	s.Router.HandleFunc("/revoke-password", s.prop(s.limit("revoke-password", handler.RevokePassword))).Methods("OPTIONS", "POST")
+	if s.Config.VerifyEmail.Secret != "" {
+		s.Router.HandleFunc("/register", s.prop(s.limit("register", handler.Register))).Methods("OPTIONS", "POST")
+		s.Router.HandleFunc("/verify-email", s.prop(s.limit("verify-email", handler.VerifyEmail))).Methods("OPTIONS", "POST")
+		s.Router.HandleFunc("/verify-email/resend", s.prop(s.limit("verify-email-resend", handler.ResendVerification))).Methods("OPTIONS", "POST")
+	}
+	s.Router.HandleFunc("/contact-us", s.prop(s.limit("contact-us", handler.ContactUs))).Methods("OPTIONS", "POST")
+	// Webhooks
+	if s.Config.Email.WebhookSecret != "" {
+		s.Router.HandleFunc("/webhooks/email", s.prop(s.emailWebhook)).Methods("OPTIONS", "POST")
+	}
+	// Admin
+	admin := AnyOf(s.Config.AdminPermissionCodes...)
+	s.protect("/admin/suppressions", admin, s.suppressions).Methods("OPTIONS", "GET")
+	s.protect("/admin/suppressions/{address}", admin, s.removeSuppression).Methods("OPTIONS", "DELETE")
+	if s.Outbox != nil {
+		s.protect("/admin/outbox/dead", admin, s.deadLetters).Methods("OPTIONS", "GET")
+		s.protect("/admin/outbox/dead/{id}/requeue", admin, s.requeueDeadLetter).Methods("OPTIONS", "POST")
+	}
+	// Development
+	if s.Config.Env == "local" || s.Config.Env == "development" {
+		s.Router.HandleFunc("/dev/email-preview", s.prop(handler.EmailPreviews)).Methods("OPTIONS", "GET")
+		s.Router.HandleFunc("/dev/email-preview/{template}", s.prop(handler.EmailPreview)).Methods("OPTIONS", "GET", "POST")
+	}
 	// Budget
 	//s.Router.HandleFunc("/budget", s.prop(handler.Budgets)).Methods("OPTIONS", "GET")
 	//s.Router.HandleFunc("/budget/-", s.prop(handler.Budget)).Methods("OPTIONS", "GET")
@@ -52,17 +173,8 @@ func (s *Server) routes() {
 }
 
 // prop propagates the http.ResponseWriter and http.Request to the handler
-// function f. Primary use is as a form of middleware to allow for CORS.
+// function f. Primary use is as a form of middleware to apply the CORS
+// policy of the Server.
 func (s *Server) prop(f func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "OPTIONS" {
-			resp := dutil.Resp{
-				Status:  200,
-				Message: "Pre-Flight Allowed",
-			}
-			resp.Respond(w, r)
-			return
-		}
-		f(w, r)
-	}
+	return s.CORS.Handler(f)
 }
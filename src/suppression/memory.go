@@ -0,0 +1,63 @@
+package suppression
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Memory is an in-process suppression store. The suppressions are not
+// shared across gateway replicas and are lost when the gateway stops.
+type Memory struct {
+	mu    sync.RWMutex
+	items map[string]Suppression
+}
+
+// NewMemory creates an empty in-process suppression store.
+func NewMemory() *Memory {
+	return &Memory{
+		items: make(map[string]Suppression),
+	}
+}
+
+func (m *Memory) Add(_ context.Context, s Suppression) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Address = Normalize(s.Address)
+	m.items[s.Address] = s
+	return nil
+}
+
+func (m *Memory) Get(_ context.Context, address string) (Suppression, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.items[Normalize(address)]
+	if !ok {
+		return Suppression{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (m *Memory) List(_ context.Context) ([]Suppression, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	xs := make([]Suppression, 0, len(m.items))
+	for _, s := range m.items {
+		xs = append(xs, s)
+	}
+	sort.Slice(xs, func(i, j int) bool {
+		return xs[i].Address < xs[j].Address
+	})
+	return xs, nil
+}
+
+func (m *Memory) Remove(_ context.Context, address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	address = Normalize(address)
+	if _, ok := m.items[address]; !ok {
+		return ErrNotFound
+	}
+	delete(m.items, address)
+	return nil
+}
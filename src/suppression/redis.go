@@ -0,0 +1,77 @@
+package suppression
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"sort"
+)
+
+// Redis is a suppression store which is shared by all the gateway replicas
+// connected to the same Redis instance. The suppressions are kept in a
+// single hash of the address to the JSON suppression.
+type Redis struct {
+	Client *redis.Client
+	Key    string
+}
+
+// NewRedis creates a suppression store backed by the Redis client.
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{
+		Client: client,
+		Key:    "flight-log-api-gateway:suppressions",
+	}
+}
+
+func (r *Redis) Add(ctx context.Context, s Suppression) error {
+	s.Address = Normalize(s.Address)
+	xb, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.Client.HSet(ctx, r.Key, s.Address, xb).Err()
+}
+
+func (r *Redis) Get(ctx context.Context, address string) (Suppression, error) {
+	xb, err := r.Client.HGet(ctx, r.Key, Normalize(address)).Bytes()
+	if err == redis.Nil {
+		return Suppression{}, ErrNotFound
+	}
+	if err != nil {
+		return Suppression{}, err
+	}
+	s := Suppression{}
+	err = json.Unmarshal(xb, &s)
+	return s, err
+}
+
+func (r *Redis) List(ctx context.Context) ([]Suppression, error) {
+	m, err := r.Client.HGetAll(ctx, r.Key).Result()
+	if err != nil {
+		return nil, err
+	}
+	xs := make([]Suppression, 0, len(m))
+	for _, v := range m {
+		s := Suppression{}
+		err = json.Unmarshal([]byte(v), &s)
+		if err != nil {
+			return nil, err
+		}
+		xs = append(xs, s)
+	}
+	sort.Slice(xs, func(i, j int) bool {
+		return xs[i].Address < xs[j].Address
+	})
+	return xs, nil
+}
+
+func (r *Redis) Remove(ctx context.Context, address string) error {
+	n, err := r.Client.HDel(ctx, r.Key, Normalize(address)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package suppression
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an address is not suppressed.
+var ErrNotFound = errors.New("address not suppressed")
+
+// The reasons for which an address is suppressed.
+const (
+	ReasonBounce    = "bounce"
+	ReasonComplaint = "complaint"
+)
+
+// Suppression is an address to which emails are no longer sent, because
+// an email to the address hard bounced or the recipient complained.
+type Suppression struct {
+	Address   string    `json:"address"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps the suppressed addresses. The addresses are normalized by
+// the store.
+type Store interface {
+	// Add suppresses the address of the suppression, an existing
+	// suppression of the address is replaced.
+	Add(ctx context.Context, s Suppression) error
+	// Get returns the suppression of the address or ErrNotFound.
+	Get(ctx context.Context, address string) (Suppression, error)
+	// List returns the suppressions ordered by address.
+	List(ctx context.Context) ([]Suppression, error)
+	// Remove clears the suppression of the address, ErrNotFound is
+	// returned if the address is not suppressed.
+	Remove(ctx context.Context, address string) error
+}
+
+// Normalize returns the lower-case address without surrounding white
+// space by which the suppressions are kept.
+func Normalize(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
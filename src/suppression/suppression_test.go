@@ -0,0 +1,56 @@
+package suppression
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	stores := map[string]Store{
+		"memory": NewMemory(),
+		"redis":  NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			_, err := store.Get(ctx, "james@bond.com")
+			if err != ErrNotFound {
+				t.Errorf("expected error %v got %v", ErrNotFound, err)
+			}
+
+			err = store.Add(ctx, Suppression{Address: " James@Bond.com", Reason: ReasonBounce, Detail: "550 mailbox unavailable", CreatedAt: created})
+			if err != nil {
+				t.Errorf("expected error %v got %v", nil, err)
+			}
+			_ = store.Add(ctx, Suppression{Address: "a@dottics.com", Reason: ReasonComplaint, CreatedAt: created})
+
+			s, err := store.Get(ctx, "JAMES@bond.com")
+			if err != nil || s.Address != "james@bond.com" || s.Reason != ReasonBounce || !s.CreatedAt.Equal(created) {
+				t.Errorf("expected the suppression of %s got %v %v", "james@bond.com", s, err)
+			}
+			xs, err := store.List(ctx)
+			if err != nil || len(xs) != 2 || xs[0].Address != "a@dottics.com" {
+				t.Errorf("expected the suppressions ordered by address got %v %v", xs, err)
+			}
+
+			err = store.Remove(ctx, "James@bond.com")
+			if err != nil {
+				t.Errorf("expected error %v got %v", nil, err)
+			}
+			err = store.Remove(ctx, "james@bond.com")
+			if err != ErrNotFound {
+				t.Errorf("expected error %v got %v", ErrNotFound, err)
+			}
+			xs, _ = store.List(ctx)
+			if len(xs) != 1 {
+				t.Errorf("expected %d suppression got %d", 1, len(xs))
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package src
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/handler"
+	"github.com/dottics/flight-log-api-gateway/src/includes"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types of the delivery events of an email.
+const (
+	EventDelivered = "delivered"
+	EventBounce    = "bounce"
+	EventComplaint = "complaint"
+)
+
+// EmailEvent is a delivery event of an email posted to the email webhook
+// by the email microservice or the email provider. BounceType is "hard"
+// or "soft" for a bounce.
+type EmailEvent struct {
+	Type       string `json:"type"`
+	Email      string `json:"email"`
+	BounceType string `json:"bounce_type"`
+	MessageID  string `json:"message_id"`
+	Detail     string `json:"detail"`
+}
+
+// webhookMaxBytes limits the size of the email webhook request body.
+const webhookMaxBytes = 1 << 20
+
+// signatureHeader is the header of the HMAC-SHA256 signature of the
+// webhook request, in the form "sha256=<hex>".
+const signatureHeader = "X-Webhook-Signature"
+
+// timestampHeader is the header of the unix time at which the webhook
+// request is signed.
+const timestampHeader = "X-Webhook-Timestamp"
+
+// emailWebhook receives the delivery events of the emails. The timestamp
+// and the body of the request must be signed with the email webhook
+// secret, and the timestamp must be within the tolerance of the webhook,
+// so that a captured request cannot be replayed. An address which hard
+// bounced or of which the recipient complained is suppressed, the other
+// events are logged.
+func (s *Server) emailWebhook(w http.ResponseWriter, r *http.Request) {
+	xb, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBytes))
+	if err != nil {
+		e := dutil.NewErr(400, "body", []string{"unable to read body", err.Error()})
+		handler.Error(w, r, e)
+		return
+	}
+	timestamp := r.Header.Get(timestampHeader)
+	if !validSignature(s.Config.Email.WebhookSecret, timestamp, xb, r.Header.Get(signatureHeader)) {
+		e := dutil.NewErr(401, "signature", []string{"invalid signature"})
+		handler.Error(w, r, e)
+		return
+	}
+	if !validTimestamp(timestamp, time.Now(), s.Config.Email.WebhookTolerance) {
+		e := dutil.NewErr(401, "timestamp", []string{"timestamp outside of the tolerance"})
+		handler.Error(w, r, e)
+		return
+	}
+
+	payload := struct {
+		Events []EmailEvent `json:"events"`
+	}{}
+	err = json.Unmarshal(xb, &payload)
+	if err != nil {
+		e := dutil.NewErr(400, "body", []string{"invalid JSON", err.Error()})
+		handler.Error(w, r, e)
+		return
+	}
+	errs := make([]string, 0)
+	for i, ev := range payload.Events {
+		switch {
+		case ev.Type != EventDelivered && ev.Type != EventBounce && ev.Type != EventComplaint:
+			errs = append(errs, fmt.Sprintf("event %d: unknown type '%s'", i, ev.Type))
+		case strings.TrimSpace(ev.Email) == "":
+			errs = append(errs, fmt.Sprintf("event %d: email required", i))
+		}
+	}
+	if len(errs) > 0 {
+		e := dutil.NewErr(400, "events", errs)
+		handler.Error(w, r, e)
+		return
+	}
+
+	suppressed := 0
+	for _, ev := range payload.Events {
+		log.Printf("email-webhook: %s %s to %s %s", ev.Type, ev.BounceType, includes.MaskEmail(ev.Email), ev.MessageID)
+		reason := ""
+		switch {
+		case ev.Type == EventBounce && ev.BounceType == "hard":
+			reason = suppression.ReasonBounce
+		case ev.Type == EventComplaint:
+			reason = suppression.ReasonComplaint
+		default:
+			continue
+		}
+		err = s.Suppressions.Add(r.Context(), suppression.Suppression{
+			Address:   ev.Email,
+			Reason:    reason,
+			Detail:    ev.Detail,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			e := dutil.NewErr(500, "suppression", []string{"unable to suppress address", err.Error()})
+			handler.Error(w, r, e)
+			return
+		}
+		suppressed++
+	}
+
+	resp := dutil.Resp{
+		Status:  200,
+		Message: "email events processed",
+		Data: map[string]interface{}{
+			"events":     len(payload.Events),
+			"suppressed": suppressed,
+		},
+	}
+	resp.Respond(w, r)
+}
+
+// validSignature reports whether the signature is the "sha256=<hex>"
+// HMAC-SHA256 of "<timestamp>.<body>" with the secret.
+func validSignature(secret, timestamp string, body []byte, signature string) bool {
+	if secret == "" || timestamp == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// validTimestamp reports whether the unix timestamp is within the
+// tolerance of now, either side.
+func validTimestamp(timestamp string, now time.Time, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	d := now.Sub(time.Unix(ts, 0))
+	return d <= tolerance && d >= -tolerance
+}
@@ -0,0 +1,166 @@
+package src
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dottics/dutil"
+	"github.com/dottics/flight-log-api-gateway/src/config"
+	"github.com/dottics/flight-log-api-gateway/src/suppression"
+	"github.com/johannesscr/micro/microtest"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	body := []byte(`{"events":[]}`)
+	ts := "1672531200"
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		valid     bool
+	}{
+		{name: "valid", secret: "s3cret", timestamp: ts, signature: sign("s3cret", ts, string(body)), valid: true},
+		{name: "other secret", secret: "s3cret", timestamp: ts, signature: sign("other", ts, string(body)), valid: false},
+		{name: "other timestamp", secret: "s3cret", timestamp: "1672531260", signature: sign("s3cret", ts, string(body)), valid: false},
+		{name: "no timestamp", secret: "s3cret", timestamp: "", signature: sign("s3cret", "", string(body)), valid: false},
+		{name: "no prefix", secret: "s3cret", timestamp: ts, signature: strings.TrimPrefix(sign("s3cret", ts, string(body)), "sha256="), valid: false},
+		{name: "not hex", secret: "s3cret", timestamp: ts, signature: "sha256=xyz", valid: false},
+		{name: "no secret", secret: "", timestamp: ts, signature: sign("", ts, string(body)), valid: false},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			if validSignature(tc.secret, tc.timestamp, body, tc.signature) != tc.valid {
+				t.Errorf("expected valid %v", tc.valid)
+			}
+		})
+	}
+}
+
+func TestValidTimestamp(t *testing.T) {
+	now := time.Unix(1672531200, 0)
+	tests := []struct {
+		name      string
+		timestamp string
+		valid     bool
+	}{
+		{name: "now", timestamp: "1672531200", valid: true},
+		{name: "within tolerance", timestamp: "1672530900", valid: true},
+		{name: "too old", timestamp: "1672530899", valid: false},
+		{name: "too new", timestamp: "1672531501", valid: false},
+		{name: "not a number", timestamp: "today", valid: false},
+		{name: "empty", timestamp: "", valid: false},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			if validTimestamp(tc.timestamp, now, 5*time.Minute) != tc.valid {
+				t.Errorf("expected valid %v", tc.valid)
+			}
+		})
+	}
+}
+
+func TestServer_emailWebhook(t *testing.T) {
+	secret := "s3cret"
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	tests := []struct {
+		name       string
+		body       string
+		timestamp  string
+		signature  string
+		status     int
+		errors     map[string][]string
+		suppressed []string
+	}{
+		{
+			name:      "invalid signature",
+			body:      `{"events":[{"type":"bounce","email":"james@bond.com","bounce_type":"hard"}]}`,
+			signature: sign("other", now, `{"events":[{"type":"bounce","email":"james@bond.com","bounce_type":"hard"}]}`),
+			status:    401,
+			errors:    map[string][]string{"signature": {"invalid signature"}},
+		},
+		{
+			name:      "replayed",
+			body:      `{"events":[{"type":"bounce","email":"james@bond.com","bounce_type":"hard"}]}`,
+			timestamp: "1672531200",
+			status:    401,
+			errors:    map[string][]string{"timestamp": {"timestamp outside of the tolerance"}},
+		},
+		{
+			name:   "invalid events",
+			body:   `{"events":[{"type":"opened","email":"james@bond.com"},{"type":"delivered"}]}`,
+			status: 400,
+			errors: map[string][]string{"events": {"event 0: unknown type 'opened'", "event 1: email required"}},
+		},
+		{
+			name: "processed",
+			body: `{"events":[` +
+				`{"type":"delivered","email":"q@mi6.com","message_id":"1"},` +
+				`{"type":"bounce","email":"M@mi6.com","bounce_type":"soft","message_id":"2"},` +
+				`{"type":"bounce","email":"James@Bond.com","bounce_type":"hard","message_id":"3","detail":"550 mailbox unavailable"},` +
+				`{"type":"complaint","email":"miss@moneypenny.com","message_id":"4"}]}`,
+			status:     200,
+			suppressed: []string{"james@bond.com", "miss@moneypenny.com"},
+		},
+	}
+
+	for i, tc := range tests {
+		name := fmt.Sprintf("%d %s", i, tc.name)
+		t.Run(name, func(t *testing.T) {
+			store := suppression.NewMemory()
+			s := &Server{
+				Config:       &config.Config{Email: config.Email{WebhookSecret: secret, WebhookTolerance: 5 * time.Minute}},
+				Suppressions: store,
+			}
+			timestamp := tc.timestamp
+			if timestamp == "" {
+				timestamp = now
+			}
+			signature := tc.signature
+			if signature == "" {
+				signature = sign(secret, timestamp, tc.body)
+			}
+			req := httptest.NewRequest("POST", "/webhooks/email", strings.NewReader(tc.body))
+			req.Header.Set("X-Webhook-Timestamp", timestamp)
+			req.Header.Set("X-Webhook-Signature", signature)
+			rec := httptest.NewRecorder()
+			s.emailWebhook(rec, req)
+			res, xb := microtest.ReadRecorder(rec)
+
+			if res.StatusCode != tc.status {
+				t.Errorf("expected status code %d got %d", tc.status, res.StatusCode)
+			}
+			resp := dutil.Resp{}
+			_ = json.Unmarshal(xb, &resp)
+			if fmt.Sprint(resp.Errors) != fmt.Sprint(tc.errors) {
+				t.Errorf("expected errors %v got %v", tc.errors, resp.Errors)
+			}
+			xs, _ := store.List(context.Background())
+			addresses := make([]string, len(xs))
+			for i, x := range xs {
+				addresses[i] = x.Address
+			}
+			if fmt.Sprint(addresses) != fmt.Sprint(tc.suppressed) && len(addresses)+len(tc.suppressed) > 0 {
+				t.Errorf("expected suppressed %v got %v", tc.suppressed, addresses)
+			}
+		})
+	}
+}